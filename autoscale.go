@@ -0,0 +1,205 @@
+package tract
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrInvalidAutoscaling is an error returned when initializing a tract whose autoscaling
+// has a minimum amount of workers above its maximum, or an interval that is not positive.
+var ErrInvalidAutoscaling = errors.New("autoscaling minimum workers above maximum")
+
+const (
+	// autoscaleShrinkInputWait is the fraction of the workers' time spent waiting on input
+	// above which the tract has more workers than it needs.
+	autoscaleShrinkInputWait = 0.5
+	// autoscaleGrowWait is the fraction of the workers' time spent waiting on input or output
+	// below which the workers themselves are the bottleneck, and more of them would help.
+	autoscaleGrowWait = 0.2
+)
+
+// autoscaler tracks how the workers of a worker tract spend their time, so the tract can decide
+// to grow or shrink its amount of workers.
+type autoscaler struct {
+	min      int
+	max      int
+	interval time.Duration
+
+	// Nanoseconds all workers spent working or waiting on output this interval.
+	// Any remaining time they spent waiting on input.
+	working    int64
+	outputWait int64
+	// Amount of workers that should retire the next time they check.
+	retiring int64
+
+	// Amount of workers started and not yet retired or finished.
+	running int
+	// finished is set once any worker found that its input has no more requests.
+	// No more workers should be started after that.
+	finished bool
+	mutex    sync.Mutex
+}
+
+// shouldRetire is checked by each worker before getting its next request.
+// Workers never retire below the minimum, so the last worker keeps the tract running until its input is finished.
+func (a *autoscaler) shouldRetire() bool {
+	if atomic.LoadInt64(&a.retiring) <= 0 {
+		return false
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.running <= a.min {
+		atomic.StoreInt64(&a.retiring, 0)
+		return false
+	}
+	if atomic.AddInt64(&a.retiring, -1) < 0 {
+		atomic.AddInt64(&a.retiring, 1)
+		return false
+	}
+	a.running--
+	return true
+}
+
+// scale decides by how many workers the tract should grow (positive) or shrink (negative) given
+// the time spent by its @workers workers this interval.
+func (a *autoscaler) scale(workers int) int {
+	var (
+		capacity   = float64(a.interval) * float64(workers)
+		working    = float64(atomic.SwapInt64(&a.working, 0)) / capacity
+		outputWait = float64(atomic.SwapInt64(&a.outputWait, 0)) / capacity
+		inputWait  = 1 - working - outputWait
+	)
+	workers -= int(atomic.LoadInt64(&a.retiring))
+	switch {
+	case inputWait > autoscaleShrinkInputWait && workers > a.min:
+		return -1
+	case inputWait < autoscaleGrowWait && outputWait < autoscaleGrowWait && workers < a.max:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func (a *autoscaler) clamp(size int) int {
+	if size < a.min {
+		return a.min
+	}
+	if size > a.max {
+		return a.max
+	}
+	return size
+}
+
+var (
+	_ Worker = autoscaleWorker{}
+	_ Output = autoscaleOutput{}
+)
+
+// autoscaleWorker is a wrapper around a Worker that records time spent working for autoscaling.
+type autoscaleWorker struct {
+	Worker
+	autoscaler *autoscaler
+}
+
+func (w autoscaleWorker) Work(r Request) (Request, bool) {
+	before := time.Now()
+	request, ok := w.Worker.Work(r)
+	atomic.AddInt64(&w.autoscaler.working, int64(time.Since(before)))
+	return request, ok
+}
+
+// autoscaleOutput is a wrapper around an Output that records time spent waiting on output for autoscaling.
+type autoscaleOutput struct {
+	Output
+	autoscaler *autoscaler
+}
+
+func (o autoscaleOutput) Put(r Request) {
+	before := time.Now()
+	o.Output.Put(r)
+	atomic.AddInt64(&o.autoscaler.outputWait, int64(time.Since(before)))
+}
+
+// autoscale periodically grows or shrinks the amount of workers in the tract until @stop is closed.
+func (p *workerTract) autoscale(ctx context.Context, workerWG *sync.WaitGroup, stop <-chan struct{}) {
+	ticker := time.NewTicker(p.autoscaler.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		switch p.autoscaler.scale(p.numberOfWorkers()) {
+		case 1:
+			p.growWorkers(ctx, workerWG)
+		case -1:
+			atomic.AddInt64(&p.autoscaler.retiring, 1)
+		}
+	}
+}
+
+// growWorkers makes and starts one more worker, unless the tract's input is already finished.
+func (p *workerTract) growWorkers(ctx context.Context, workerWG *sync.WaitGroup) {
+	worker, err := p.factory.MakeWorker()
+	if err != nil {
+		// Try again next interval.
+		return
+	}
+	p.autoscaler.mutex.Lock()
+	defer p.autoscaler.mutex.Unlock()
+	if p.autoscaler.finished {
+		worker.Close()
+		return
+	}
+	// Other workers are still running while the input isn't finished, so the tract can't have stopped waiting on them.
+	p.autoscaler.running++
+	p.workersMutex.Lock()
+	i := len(p.workers)
+	for j := range p.workers {
+		if p.workers[j] == nil {
+			i = j
+			break
+		}
+	}
+	if i == len(p.workers) {
+		p.workers = append(p.workers, nil)
+	}
+	p.workers[i] = worker
+	p.workersMutex.Unlock()
+	p.startWorker(ctx, workerWG, i, worker)
+}
+
+// retireWorker closes a worker that stopped processing because the tract shrank.
+func (p *workerTract) retireWorker(i int) {
+	p.workersMutex.Lock()
+	worker := p.workers[i]
+	p.workers[i] = nil
+	p.workersMutex.Unlock()
+	worker.Close()
+}
+
+// finishWorker marks that a worker stopped processing because its input has no more requests.
+func (p *workerTract) finishWorker() {
+	p.autoscaler.mutex.Lock()
+	p.autoscaler.finished = true
+	p.autoscaler.running--
+	p.autoscaler.mutex.Unlock()
+}
+
+func (p *workerTract) numberOfWorkers() int {
+	p.workersMutex.Lock()
+	defer p.workersMutex.Unlock()
+	n := 0
+	for _, worker := range p.workers {
+		if worker != nil {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,34 @@
+package tract
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAutoscalerScale(t *testing.T) {
+	tests := []struct {
+		name          string
+		workers       int
+		working       time.Duration
+		outputWait    time.Duration
+		expectedScale int
+	}{
+		{name: "idle", workers: 2, working: 0, outputWait: 0, expectedScale: -1},
+		{name: "idle at min", workers: 1, working: 0, outputWait: 0, expectedScale: 0},
+		{name: "busy", workers: 2, working: 2 * time.Second, outputWait: 0, expectedScale: 1},
+		{name: "busy at max", workers: 4, working: 4 * time.Second, outputWait: 0, expectedScale: 0},
+		{name: "blocked on output", workers: 2, working: time.Second, outputWait: time.Second, expectedScale: 0},
+	}
+	for _, test := range tests {
+		a := &autoscaler{
+			min:        1,
+			max:        4,
+			interval:   time.Second,
+			working:    int64(test.working),
+			outputWait: int64(test.outputWait),
+		}
+		if scale := a.scale(test.workers); scale != test.expectedScale {
+			t.Errorf("%s: scale: expected %d, received %d", test.name, test.expectedScale, scale)
+		}
+	}
+}
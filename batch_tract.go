@@ -0,0 +1,304 @@
+package tract
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrBatchAsHead is en error returned when a batch tract doesn't have its
+// input set. Aka there should be another Tract feeding into it.
+var ErrBatchAsHead = errors.New("batch tract detected with no set input")
+
+// BatchWorkerFactory makes potentially many BatchWorker objects that may use resources managed by the factory.
+// It is the batch equivalent of a WorkerFactory.
+type BatchWorkerFactory interface {
+	// MakeBatchWorker makes a batch worker expected to run in a batch tract.
+	// This BatchWorker contructor will be called once per worker needed for a Batch Tract.
+	MakeBatchWorker() (BatchWorker, error)
+	// Close closes factory resources
+	Close()
+}
+
+// BatchWorker is an object that performs work on many requests at once potentially using it own resources and/or factory resources.
+type BatchWorker interface {
+	// Work takes a batch of requests, performs an operation on all of them, and returns the batch and a success flag
+	// for each request in it. If the flag for a request is false, that specifies that the request should be discarded.
+	// Requests left out of the returned batch are discarded as well.
+	Work([]Request) ([]Request, []bool)
+	// Close closes worker resources
+	Close()
+}
+
+var (
+	_ Tract              = &batchTract{}
+	_ BatchWorkerFactory = batchWorkerAsFactory{}
+	_ WorkerFactory      = batchWorkerFactory{}
+	_ Worker             = batchWorker{}
+	_ Input              = &batchInput{}
+	_ Output             = batchOutput{}
+)
+
+// NewBatchFactoryFromWorker makes a BatchWorkerFactory from a provided BatchWorker.
+// It is the batch equivalent of NewFactoryFromWorker.
+func NewBatchFactoryFromWorker(worker BatchWorker) BatchWorkerFactory {
+	return batchWorkerAsFactory{worker: worker}
+}
+
+type batchWorkerAsFactory struct {
+	worker BatchWorker
+}
+
+func (f batchWorkerAsFactory) MakeBatchWorker() (BatchWorker, error) {
+	return nonCloseBatchWorker{f.worker}, nil
+}
+
+func (f batchWorkerAsFactory) Close() {
+	f.worker.Close()
+}
+
+type nonCloseBatchWorker struct {
+	BatchWorker
+}
+
+func (f nonCloseBatchWorker) Close() {}
+
+// NewBatchTract makes a new tract that will spin up @size number of batch workers generated from @workerFactory.
+// The tract collects requests from its input into batches of up to @batchSize requests, waiting at most @maxWait after
+// the first request of a batch for the rest of it (zero waits for a full batch). Each batch is worked at once by one
+// batch worker, then the requests in it are individually passed along to the output of the tract. Use the
+// WithBatchedOutput option to pass along the whole batch as a single request instead.
+// The Worker Tract options apply to batch tracts the same, with each batch counting as a single request.
+// This Tract should not be the first tract in a group as it has no machanism of closing on it's own.
+// Aka it's input must be set to something.
+func NewBatchTract(name string, size int, batchSize int, maxWait time.Duration, workerFactory BatchWorkerFactory, options ...WorkerTractOption) Tract {
+	p := &batchTract{
+		batchSize: batchSize,
+		maxWait:   maxWait,
+		input:     InputGenerator{},
+	}
+	p.workerTract = NewWorkerTract(name, size, nil, options...).(*workerTract)
+	p.workerTract.factory = batchWorkerFactory{
+		BatchWorkerFactory: workerFactory,
+		tract:              p.workerTract,
+	}
+	p.SetOutput(p.workerTract.output)
+	return p
+}
+
+type batchTract struct {
+	*workerTract
+	// Input to collect batches from
+	input Input
+	// Maximum amount of requests in a batch
+	batchSize int
+	// Maximum time to wait for a batch to fill
+	maxWait time.Duration
+}
+
+func (p *batchTract) Init() error {
+	if _, weAreHeadTract := p.input.(InputGenerator); weAreHeadTract {
+		return &InitError{Path: p.name, Err: ErrBatchAsHead}
+	}
+	return p.workerTract.Init()
+}
+
+func (p *batchTract) Start() func() {
+	return p.StartContext(context.Background())
+}
+
+func (p *batchTract) StartContext(ctx context.Context) func() {
+	in := newBatchInput(ctx, p.input, p.batchSize, p.maxWait)
+	p.workerTract.SetInput(in)
+	wait := p.workerTract.StartContext(ctx)
+	return func() {
+		wait()
+		// Any requests left after the workers are done were cancelled along with the tract.
+		for r := range in.requests {
+			cleanupRequest(r, false)
+		}
+	}
+}
+
+func (p *batchTract) SetInput(in Input) {
+	p.input = in
+}
+
+func (p *batchTract) SetOutput(out Output) {
+	p.workerTract.SetOutput(batchOutput{
+		Output:  out,
+		unbatch: !p.workerTract.batchedOutput,
+	})
+}
+
+// requestBatchKey is the key to retreive the requests in a batch request.
+// Request value type is []Request
+type requestBatchKey struct{}
+
+// GetRequestBatch gets the requests in a batch request made by a batch tract using the WithBatchedOutput option.
+// If the request is not a batch request, nil is returned.
+func GetRequestBatch(r Request) []Request {
+	batch, _ := r.Value(requestBatchKey{}).([]Request)
+	return batch
+}
+
+func setRequestBatch(r Request, batch []Request) Request {
+	return context.WithValue(r, requestBatchKey{}, batch)
+}
+
+// newBatchRequest makes a single request holding a batch of requests.
+// The requests in the batch are cleaned up along with the batch request.
+func newBatchRequest(ctx context.Context, batch []Request) Request {
+	r := setRequestStartTime(ctx, GetRequestStartTime(batch[0]))
+	r = setRequestBatch(r, batch)
+	return AddRequestCleanup(r, func(r Request, success bool) {
+		for _, request := range GetRequestBatch(r) {
+			cleanupRequest(request, success)
+		}
+	})
+}
+
+// batchWorkerFactory adapts a BatchWorkerFactory into a WorkerFactory making workers that work batch requests.
+type batchWorkerFactory struct {
+	BatchWorkerFactory
+	tract *workerTract
+}
+
+func (f batchWorkerFactory) MakeWorker() (Worker, error) {
+	worker, err := f.BatchWorkerFactory.MakeBatchWorker()
+	if err != nil {
+		return nil, err
+	}
+	return batchWorker{
+		BatchWorker: worker,
+		tract:       f.tract,
+	}, nil
+}
+
+type batchWorker struct {
+	BatchWorker
+	tract *workerTract
+}
+
+// Work works the requests in a batch request. Requests in the batch the BatchWorker does not send are rejected
+// individually by the tract, and the remaining requests are kept in the batch. Requests the BatchWorker leaves
+// out of the batch it returns are rejected too, so their cleanups still run.
+func (w batchWorker) Work(r Request) (Request, bool) {
+	members := GetRequestBatch(r)
+	// Mark each request with its place in the batch, to find the ones that are not returned.
+	marked := make([]Request, len(members))
+	for i, member := range members {
+		marked[i] = context.WithValue(member, batchMemberKey{}, i)
+	}
+	requests, shouldSend := w.BatchWorker.Work(marked)
+	returned := make([]bool, len(members))
+	batch := make([]Request, 0, len(requests))
+	for i, request := range requests {
+		if member, ok := request.Value(batchMemberKey{}).(int); ok && member < len(returned) {
+			returned[member] = true
+		}
+		if i < len(shouldSend) && shouldSend[i] {
+			batch = append(batch, request)
+		} else {
+			w.tract.reject(request)
+		}
+	}
+	for i, member := range members {
+		if !returned[i] {
+			w.tract.reject(member)
+		}
+	}
+	return setRequestBatch(r, batch), true
+}
+
+// batchMemberKey is the key to retreive the place of a request in the batch given to a BatchWorker.
+// Context value type is int
+type batchMemberKey struct{}
+
+// batchInput is an Input that collects requests from its inner input into batch requests.
+// Like a link between tracts, the workers keep getting from it until it is closed, so requests
+// the collector already took from the inner input are drained even once the tract is cancelled.
+type batchInput struct {
+	// Requests gotten from the inner input, closed when there are no more.
+	requests chan Request
+	// Serializes collecting batches between workers.
+	mutex     sync.Mutex
+	ctx       context.Context
+	batchSize int
+	maxWait   time.Duration
+}
+
+func newBatchInput(ctx context.Context, in Input, batchSize int, maxWait time.Duration) *batchInput {
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	i := &batchInput{
+		requests:  make(chan Request, batchSize),
+		ctx:       ctx,
+		batchSize: batchSize,
+		maxWait:   maxWait,
+	}
+	go func() {
+		defer close(i.requests)
+		in := contextInput{Input: in, ctx: ctx}
+		for {
+			request, ok := in.Get()
+			if !ok {
+				return
+			}
+			i.requests <- request
+		}
+	}()
+	return i
+}
+
+// Get collects the next batch of requests.
+func (i *batchInput) Get() (Request, bool) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	request, ok := <-i.requests
+	if !ok {
+		return nil, false
+	}
+	batch := []Request{request}
+	var timeout <-chan time.Time
+	if i.maxWait > 0 {
+		timer := time.NewTimer(i.maxWait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	for len(batch) < i.batchSize {
+		select {
+		case request, ok := <-i.requests:
+			if !ok {
+				return newBatchRequest(i.ctx, batch), true
+			}
+			batch = append(batch, request)
+		case <-timeout:
+			return newBatchRequest(i.ctx, batch), true
+		}
+	}
+	return newBatchRequest(i.ctx, batch), true
+}
+
+// batchOutput is an Output wrapper that outputs batch requests, or each request in them individually.
+// Batch requests left with no requests in them are dropped.
+type batchOutput struct {
+	Output
+	unbatch bool
+}
+
+func (o batchOutput) Put(r Request) {
+	batch := GetRequestBatch(r)
+	if len(batch) == 0 {
+		return
+	}
+	if !o.unbatch {
+		o.Output.Put(r)
+		return
+	}
+	for _, request := range batch {
+		o.Output.Put(request)
+	}
+}
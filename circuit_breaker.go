@@ -0,0 +1,228 @@
+package tract
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is the error attached to a request that was not worked because its worker's circuit breaker was open.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// CircuitState is the state of a circuit breaker.
+type CircuitState int
+
+const (
+	// CircuitClosed lets all requests be worked.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen keeps requests from being worked.
+	CircuitOpen
+	// CircuitHalfOpen lets a single request at a time be worked as a probe.
+	CircuitHalfOpen
+)
+
+// CircuitBreakerOption is a function option applyable to circuit breakers.
+type CircuitBreakerOption func(*circuitBreaker)
+
+// WithCircuitFallback creates a CircuitBreakerOption that will work requests using @fallback while the
+// circuit breaker is open, instead of failing them with ErrCircuitOpen. The fallback is shared by all
+// the workers, so its Work() function must be thread safe. It is closed when the factory is closed.
+// By default requests are failed while the circuit breaker is open.
+func WithCircuitFallback(fallback Worker) CircuitBreakerOption {
+	return func(b *circuitBreaker) {
+		b.fallback = fallback
+	}
+}
+
+// WithCircuitMetricsHandler creates a CircuitBreakerOption that will report each change of the circuit
+// breaker's state as a MetricsKeyCircuitState metric. State changes are rare, and are reported even when
+// the handler's ShouldHandle() returns false.
+// By default state changes are not reported.
+func WithCircuitMetricsHandler(mh MetricsHandler) CircuitBreakerOption {
+	return func(b *circuitBreaker) {
+		b.metricsHandler = mh
+	}
+}
+
+var (
+	_ WorkerFactory = circuitBreakerFactory{}
+	_ Worker        = circuitBreakerWorker{}
+)
+
+// NewCircuitBreakerFactory makes a WorkerFactory whose workers work requests using workers made by @factory,
+// sharing a single circuit breaker. The circuit breaker keeps track of the last @window requests worked, and
+// opens once at least @threshold (a fraction between 0 and 1) of them failed with an error. A threshold above 1
+// is treated as 1, and a threshold that is not positive opens on a single failure in the window. While open,
+// requests are failed with ErrCircuitOpen without being worked. After @openDuration, the circuit breaker
+// half opens and works a single request at a time as a probe: if it succeeds the circuit breaker closes,
+// and if it fails the circuit breaker opens again. Only requests failed with an error count as failures;
+// requests a worker discards without an error count the same as successful ones.
+func NewCircuitBreakerFactory(factory WorkerFactory, threshold float64, window int, openDuration time.Duration, options ...CircuitBreakerOption) WorkerFactory {
+	if window < 1 {
+		window = 1
+	}
+	if threshold > 1 {
+		threshold = 1
+	} else if !(threshold > 0) {
+		threshold = 1 / float64(window)
+	}
+	breaker := &circuitBreaker{
+		threshold:    threshold,
+		openDuration: openDuration,
+		results:      make([]bool, window),
+	}
+	for _, option := range options {
+		option(breaker)
+	}
+	return circuitBreakerFactory{
+		WorkerFactory: factory,
+		breaker:       breaker,
+	}
+}
+
+type circuitBreakerFactory struct {
+	WorkerFactory
+	breaker *circuitBreaker
+}
+
+func (f circuitBreakerFactory) MakeWorker() (Worker, error) {
+	worker, err := f.WorkerFactory.MakeWorker()
+	if err != nil {
+		return nil, err
+	}
+	return circuitBreakerWorker{
+		Worker:  worker,
+		breaker: f.breaker,
+	}, nil
+}
+
+func (f circuitBreakerFactory) Close() {
+	f.WorkerFactory.Close()
+	if f.breaker.fallback != nil {
+		f.breaker.fallback.Close()
+	}
+}
+
+type circuitBreakerWorker struct {
+	Worker
+	breaker *circuitBreaker
+}
+
+func (w circuitBreakerWorker) Work(r Request) (Request, bool) {
+	allowed, probe := w.breaker.allow()
+	if !allowed {
+		if w.breaker.fallback != nil {
+			return w.breaker.fallback.Work(r)
+		}
+		return setRequestError(r, ErrCircuitOpen), false
+	}
+	// A worker that panics is recorded as failing, so a probe it panicked on doesn't keep the circuit breaker half open.
+	failed := true
+	defer func() {
+		w.breaker.record(probe, failed)
+	}()
+	request, ok := w.Worker.Work(r)
+	failed = !ok && GetRequestError(request) != nil
+	return request, ok
+}
+
+// circuitBreaker is shared by all the workers made by a circuit breaker factory.
+type circuitBreaker struct {
+	// Fraction of requests in the window that have to fail to open
+	threshold float64
+	// How long to stay open before half opening
+	openDuration time.Duration
+	// Worker used while open (optional)
+	fallback Worker
+	// Handler for state changes (optional)
+	metricsHandler MetricsHandler
+
+	mutex sync.Mutex
+	state CircuitState
+	// Whether each of the last requests failed, as a ring
+	results []bool
+	// Index of the oldest result in the ring
+	next int
+	// Amount of results in the ring, and how many of them failed
+	count    int
+	failures int
+	// When the circuit breaker last opened
+	openedAt time.Time
+	// Set while a probe is being worked when half open
+	probing bool
+}
+
+// allow checks if a request should be worked, and if it is a probe.
+func (b *circuitBreaker) allow() (allowed, probe bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	switch b.state {
+	case CircuitOpen:
+		if time.Since(b.openedAt) < b.openDuration {
+			return false, false
+		}
+		b.setState(CircuitHalfOpen)
+		fallthrough
+	case CircuitHalfOpen:
+		if b.probing {
+			return false, false
+		}
+		b.probing = true
+		return true, true
+	default:
+		return true, false
+	}
+}
+
+// record records the result of a worked request.
+func (b *circuitBreaker) record(probe, failed bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if probe {
+		b.probing = false
+		if failed {
+			b.open()
+		} else {
+			b.close()
+		}
+		return
+	}
+	if b.state != CircuitClosed {
+		// Requests that started before the circuit breaker opened don't count towards closing it.
+		return
+	}
+	if b.count == len(b.results) {
+		if b.results[b.next] {
+			b.failures--
+		}
+	} else {
+		b.count++
+	}
+	b.results[b.next] = failed
+	if failed {
+		b.failures++
+	}
+	b.next = (b.next + 1) % len(b.results)
+	if b.count == len(b.results) && float64(b.failures) >= b.threshold*float64(b.count) {
+		b.open()
+	}
+}
+
+func (b *circuitBreaker) open() {
+	b.openedAt = time.Now()
+	b.setState(CircuitOpen)
+}
+
+func (b *circuitBreaker) close() {
+	b.next, b.count, b.failures = 0, 0, 0
+	b.setState(CircuitClosed)
+}
+
+func (b *circuitBreaker) setState(state CircuitState) {
+	b.state = state
+	if b.metricsHandler != nil {
+		b.metricsHandler.HandleMetrics(
+			Metric{Key: MetricsKeyCircuitState, Count: int64(state)},
+		)
+	}
+}
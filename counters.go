@@ -0,0 +1,65 @@
+package tract
+
+import "sync/atomic"
+
+// tractCounters counts the requests a worker tract handles, shared by all its workers.
+// Counts of requests are kept since they were last reported, so that every request is
+// reported even though metrics are only handled for some of them.
+type tractCounters struct {
+	received  int64
+	completed int64
+	rejected  int64
+	failed    int64
+	// Requests gotten from the input that have not been outputted or rejected yet
+	inFlight int64
+	// Workers currently working a request
+	busyWorkers int64
+}
+
+// receive counts a request gotten from the tract's input.
+func (c *tractCounters) receive() {
+	atomic.AddInt64(&c.received, 1)
+	atomic.AddInt64(&c.inFlight, 1)
+}
+
+// work counts a worker starting or finishing working a request.
+func (c *tractCounters) work(working bool) {
+	if working {
+		atomic.AddInt64(&c.busyWorkers, 1)
+	} else {
+		atomic.AddInt64(&c.busyWorkers, -1)
+	}
+}
+
+// finish counts a request leaving the tract, either by being outputted if @sent, or being rejected.
+// Rejected requests with an error attached count as failed.
+func (c *tractCounters) finish(r Request, sent bool) {
+	switch {
+	case sent:
+		atomic.AddInt64(&c.completed, 1)
+	case GetRequestError(r) != nil:
+		atomic.AddInt64(&c.failed, 1)
+	default:
+		atomic.AddInt64(&c.rejected, 1)
+	}
+	atomic.AddInt64(&c.inFlight, -1)
+}
+
+// fail counts a request leaving the tract without being worked because the tract was cancelled.
+func (c *tractCounters) fail() {
+	atomic.AddInt64(&c.failed, 1)
+	atomic.AddInt64(&c.inFlight, -1)
+}
+
+// report reports the counts since they were last reported, and the current gauges, to @mh.
+func (c *tractCounters) report(mh MetricsHandler, workers int) {
+	mh.HandleMetrics(
+		Metric{Key: MetricsKeyReceived, Count: atomic.SwapInt64(&c.received, 0)},
+		Metric{Key: MetricsKeyCompleted, Count: atomic.SwapInt64(&c.completed, 0)},
+		Metric{Key: MetricsKeyRejected, Count: atomic.SwapInt64(&c.rejected, 0)},
+		Metric{Key: MetricsKeyFailed, Count: atomic.SwapInt64(&c.failed, 0)},
+		Metric{Key: MetricsKeyInFlight, Count: atomic.LoadInt64(&c.inFlight)},
+		Metric{Key: MetricsKeyWorkers, Count: int64(workers)},
+		Metric{Key: MetricsKeyBusyWorkers, Count: atomic.LoadInt64(&c.busyWorkers)},
+	)
+}
@@ -0,0 +1,113 @@
+package tract
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// DrainReport reports how the requests in a tract finished while it was being drained.
+// Requests are counted when they are cleaned up, so requests outputted to a user specified
+// output are only counted if they were cleaned up before draining finished.
+type DrainReport struct {
+	// Completed is the amount of requests that finished successfully while draining.
+	Completed int64
+	// Abandoned is the amount of requests that failed, or were cancelled when the deadline passed.
+	Abandoned int64
+}
+
+// StartDrainable starts @tract the same as StartContext, and returns a function that drains it instead of the
+// usual closure. The drain function stops the tract from getting new requests from its input, and waits up to
+// @timeout for the requests already in the tract to pass through all of its stages. Once @timeout elapses, the
+// tract is cancelled: requests still in the tract are cleaned up as failed without being worked.
+// The drain function blocks until the tract has finished, and reports how many requests completed or were
+// abandoned while draining. It should only be called once.
+// As with StartContext, a tract waiting on a user set input that is neither an InputChannel nor an
+// InterruptibleInput keeps waiting on it until it returns, even once the drain deadline has passed.
+func StartDrainable(ctx context.Context, tract Tract) func(timeout time.Duration) DrainReport {
+	drain := &drainState{stop: make(chan struct{})}
+	ctx, cancel := context.WithCancel(context.WithValue(ctx, drainKey{}, drain))
+	var stop context.CancelFunc
+	drain.ctx, stop = context.WithCancel(ctx)
+	wait := StartContext(ctx, tract)
+	return func(timeout time.Duration) DrainReport {
+		defer cancel()
+		atomic.StoreInt32(&drain.draining, 1)
+		close(drain.stop)
+		stop()
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			wait()
+		}()
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		select {
+		case <-done:
+		case <-timer.C:
+			cancel()
+			<-done
+		}
+		return DrainReport{
+			Completed: atomic.LoadInt64(&drain.completed),
+			Abandoned: atomic.LoadInt64(&drain.abandoned),
+		}
+	}
+}
+
+// drainKey is the key to retreive the drain state from a tract's context.
+// Context value type is *drainState
+type drainKey struct{}
+
+// drainState is shared by all the tracts started by StartDrainable.
+type drainState struct {
+	// Closed once the tract should stop getting new requests
+	stop chan struct{}
+	// Done once the tract should stop getting new requests, or is cancelled
+	ctx context.Context
+	// Set once the tract started draining
+	draining int32
+	// Amount of requests that finished while draining
+	completed int64
+	abandoned int64
+}
+
+func getDrainState(ctx context.Context) *drainState {
+	drain, _ := ctx.Value(drainKey{}).(*drainState)
+	return drain
+}
+
+// stopped gets a channel that is closed once the tract should stop getting new requests.
+// It is nil if the tract is not drainable.
+func (s *drainState) stopped() <-chan struct{} {
+	if s == nil {
+		return nil
+	}
+	return s.stop
+}
+
+// context gets a context that is done once the tract should stop getting new requests,
+// for a tract started with @ctx.
+func (s *drainState) context(ctx context.Context) context.Context {
+	if s == nil {
+		return ctx
+	}
+	return s.ctx
+}
+
+// track counts how a request that entered the tract finishes, if it finishes while draining.
+func (s *drainState) track(r Request) Request {
+	if s == nil {
+		return r
+	}
+	return addRequestFinalizer(r, func(_ Request, success bool) {
+		if atomic.LoadInt32(&s.draining) == 0 {
+			return
+		}
+		if success {
+			atomic.AddInt64(&s.completed, 1)
+		} else {
+			atomic.AddInt64(&s.abandoned, 1)
+		}
+	})
+}
@@ -41,6 +41,15 @@ func (h *exampleMetricsHandler) HandleMetrics(metrics ...tract.Metric) {
 		// The request has reached the end of the line. How long since the request was created?
 		case tract.MetricsKeyTract:
 			metricsKey = "tract"
+		// How long did we spend working on a request that failed with an error?
+		case tract.MetricsKeyError:
+			metricsKey = "error"
+		// How long did we spend on a single attempt at working the request when retrying?
+		case tract.MetricsKeyAttempt:
+			metricsKey = "attempt"
+		// How long did we spend waiting on the tract's rate limit?
+		case tract.MetricsKeyRateLimit:
+			metricsKey = "ratelimit"
 		// Either an invalid metrics key, one we don't know about, or one we don't care about.
 		default:
 			metricsKey = "unknown"
@@ -77,3 +86,35 @@ func ExampleMetricsHandler() {
 
 	myTract.Start()()
 }
+
+// ExampleHistogramMetricsHandler shows an example of reporting the tail latency of each tract.
+func ExampleHistogramMetricsHandler() {
+	// Unlike a handler that keeps context of the Tract it's handling, one histogram handler
+	// can be shared by every Tract, as metrics are labeled with the Tract that produced them.
+	histograms := tract.NewHistogramMetricsHandler(tract.NewEveryNMetricsThrottler(10))
+	myTract := tract.NewSerialGroupTract("my tract",
+		// ...
+		tract.NewWorkerTract("square root", 4,
+			tract.NewFactoryFromWorker(SquareRootWorker{}),
+			tract.WithMetricsHandler(histograms),
+		),
+		// ...
+	)
+
+	err := myTract.Init()
+	if err != nil {
+		// Handle error
+		return
+	}
+
+	// Report each minute's latencies.
+	go func() {
+		for range time.Tick(time.Minute) {
+			for _, snapshot := range histograms.Reset() {
+				fmt.Printf("%s :: %d :: p50 %v :: p99 %v :: max %v\n", snapshot.Path, snapshot.Key, snapshot.P50, snapshot.P99, snapshot.Max)
+			}
+		}
+	}()
+
+	myTract.Start()()
+}
@@ -0,0 +1,215 @@
+package tract
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrBranchTimeout is the error of a BranchResult for an inner tract of a fan out join group
+// that did not finish its copy of a request before the join timed out.
+var ErrBranchTimeout = errors.New("fan out branch timed out")
+
+// BranchResult is how one inner tract of a fan out join group finished its copy of a request.
+type BranchResult struct {
+	// Request is the copy of the request as the inner tract finished it.
+	// It is nil if the inner tract did not finish it before the join timed out.
+	Request Request
+	// Err is why the inner tract failed the request, or nil if it succeeded.
+	// Requests failed without an error of their own have ErrRequestRejected.
+	Err error
+}
+
+var (
+	_ Output = joinOutput{}
+)
+
+// fanOutJoinTract puts a copy of each request to all of its outputs, and joins the copies back into
+// a single request once they have all finished their inner tracts.
+type fanOutJoinTract struct {
+	// Name of the group: used for rejected requests
+	name    string
+	input   Input
+	outputs []Output
+	// Output of the merged requests
+	output Output
+	// Output of the merged requests that are rejected (optional)
+	rejectOutput Output
+	merge        func(Request, []BranchResult) (Request, bool)
+	timeout      time.Duration
+	// Joins that have not been merged yet
+	pending sync.WaitGroup
+}
+
+func (p *fanOutJoinTract) Name() string {
+	return "fanout join"
+}
+
+func (p *fanOutJoinTract) Init() error {
+	return nil
+}
+
+func (p *fanOutJoinTract) Start() func() {
+	return p.StartContext(context.Background())
+}
+
+func (p *fanOutJoinTract) StartContext(ctx context.Context) func() {
+	input := contextInput{Input: p.input, ctx: ctx}
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			inputValue, ok := input.Get()
+			if !ok {
+				break
+			}
+			if ctx.Err() != nil {
+				cleanupRequest(inputValue, false)
+				continue
+			}
+			p.scatter(inputValue)
+		}
+	}()
+
+	return func() {
+		wg.Wait()
+		for _, output := range p.outputs {
+			output.Close()
+		}
+	}
+}
+
+// scatter puts a copy of the request to every output. Each copy's cleanups are replaced with a finalizer
+// reporting to the request's join, so the request's own cleanups only run once it is merged.
+func (p *fanOutJoinTract) scatter(r Request) {
+	j := &join{
+		tract:     p,
+		request:   r,
+		results:   make([]BranchResult, len(p.outputs)),
+		reported:  make([]bool, len(p.outputs)),
+		remaining: len(p.outputs),
+	}
+	p.pending.Add(1)
+	if p.timeout > 0 {
+		j.mutex.Lock()
+		j.timer = time.AfterFunc(p.timeout, j.expire)
+		j.mutex.Unlock()
+	}
+	for i, output := range p.outputs {
+		i := i
+		branchRequest, _, _ := swapCleanups(r, nil, cleanups{func(r Request, success bool) {
+			j.report(i, r, success)
+		}})
+		output.Put(branchRequest)
+	}
+}
+
+// gather merges a request whose copies have all finished, or timed out.
+func (p *fanOutJoinTract) gather(j *join) {
+	defer p.pending.Done()
+	r, ok := p.merge(j.request, j.results)
+	if ok {
+		p.output.Put(r)
+		return
+	}
+	if p.rejectOutput == nil {
+		cleanupRequest(r, false)
+		return
+	}
+	r = setRequestRejectedBy(r, p.name)
+	if GetRequestError(r) == nil {
+		r = setRequestError(r, ErrRequestRejected)
+	}
+	p.rejectOutput.Put(r)
+}
+
+func (p *fanOutJoinTract) SetInput(in Input) {
+	p.input = in
+}
+
+// fanOutJoinTract is never available directly externally. It's outputs are only set internally,
+// so this implementation of ever growing number of outputs is not liable to growing out of control.
+func (p *fanOutJoinTract) SetOutput(out Output) {
+	p.outputs = append(p.outputs, out)
+}
+
+// fanOutJoinTract never rejects requests; merged requests are rejected to the group's reject output.
+func (p *fanOutJoinTract) SetRejectOutput(out Output) {}
+
+// join keeps track of the copies of a request until they are merged.
+type join struct {
+	tract   *fanOutJoinTract
+	request Request
+	results []BranchResult
+	// Whether the copy sent to each output has finished. Inner tracts that fan out
+	// finish their copy more than once; only the first time counts.
+	reported []bool
+	// Amount of copies that have not finished
+	remaining int
+	timer     *time.Timer
+	// Set once the request has been merged; copies finishing after are ignored
+	done  bool
+	mutex sync.Mutex
+}
+
+// report records how the copy of the request sent to output @i finished.
+func (j *join) report(i int, r Request, success bool) {
+	j.mutex.Lock()
+	if j.done || j.reported[i] {
+		j.mutex.Unlock()
+		return
+	}
+	j.reported[i] = true
+	result := BranchResult{Request: r}
+	if !success {
+		result.Err = GetRequestError(r)
+		if result.Err == nil {
+			result.Err = ErrRequestRejected
+		}
+	}
+	j.results[i] = result
+	j.remaining--
+	j.done = j.remaining == 0
+	done, timer := j.done, j.timer
+	j.mutex.Unlock()
+	if !done {
+		return
+	}
+	if timer != nil {
+		timer.Stop()
+	}
+	j.tract.gather(j)
+}
+
+// expire merges the request without waiting on the copies that have not finished.
+func (j *join) expire() {
+	j.mutex.Lock()
+	if j.done {
+		j.mutex.Unlock()
+		return
+	}
+	j.done = true
+	for i := range j.results {
+		if !j.reported[i] {
+			j.results[i].Err = ErrBranchTimeout
+		}
+	}
+	j.mutex.Unlock()
+	j.tract.gather(j)
+}
+
+// joinOutput is the output of the inner tracts of a fan out join group.
+// Requests put to it end their trip through the inner tract, reporting to their join.
+type joinOutput struct {
+	success bool
+}
+
+// Put cleans up the copy of the request, which reports it to its join.
+func (o joinOutput) Put(r Request) {
+	cleanupRequest(r, o.success)
+}
+
+// Close is a noop.
+func (o joinOutput) Close() {}
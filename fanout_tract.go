@@ -1,10 +1,20 @@
 package tract
 
-import "sync"
+import (
+	"context"
+	"sync"
+)
 
 type fanOutTract struct {
 	input   Input
 	outputs []Output
+	// Decide which outputs each request is put to, in the same order as the outputs (optional).
+	// Outputs with a nil predicate get every request.
+	predicates []func(Request) bool
+	// Handler for the amount of outputs each request is put to (optional)
+	metricsHandler MetricsHandler
+	// Name of the group: used for metrics
+	name string
 }
 
 func (p *fanOutTract) Name() string {
@@ -16,18 +26,33 @@ func (p *fanOutTract) Init() error {
 }
 
 func (p *fanOutTract) Start() func() {
+	return p.StartContext(context.Background())
+}
+
+func (p *fanOutTract) StartContext(ctx context.Context) func() {
+	input := contextInput{Input: p.input, ctx: ctx}
+	// The group has already added itself to the path.
+	metricsHandler := newTractMetricsHandler(p.metricsHandler, p.name, tractPath(ctx), -1)
 	wg := &sync.WaitGroup{}
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
 		for {
-			inputValue, ok := p.input.Get()
+			inputValue, ok := input.Get()
 			if !ok {
 				break
 			}
-			for _, output := range p.outputs {
-				output.Put(inputValue)
+			if ctx.Err() != nil {
+				cleanupRequest(inputValue, false)
+				continue
+			}
+			if p.predicates == nil {
+				for _, output := range p.outputs {
+					output.Put(inputValue)
+				}
+				continue
 			}
+			p.putMatching(inputValue, metricsHandler)
 		}
 	}()
 
@@ -39,6 +64,26 @@ func (p *fanOutTract) Start() func() {
 	}
 }
 
+// putMatching puts the request to the outputs whose predicate it matches.
+// Requests that match none of them are cleaned up as failed.
+func (p *fanOutTract) putMatching(r Request, metricsHandler MetricsHandler) {
+	var branches int64
+	for i, output := range p.outputs {
+		if p.predicates[i] == nil || p.predicates[i](r) {
+			output.Put(r)
+			branches++
+		}
+	}
+	if metricsHandler != nil && metricsHandler.ShouldHandle() {
+		metricsHandler.HandleMetrics(
+			Metric{Key: MetricsKeyBranches, Count: branches},
+		)
+	}
+	if branches == 0 {
+		cleanupRequest(r, false)
+	}
+}
+
 func (p *fanOutTract) SetInput(in Input) {
 	p.input = in
 }
@@ -48,3 +93,6 @@ func (p *fanOutTract) SetInput(in Input) {
 func (p *fanOutTract) SetOutput(out Output) {
 	p.outputs = append(p.outputs, out)
 }
+
+// fanOutTract never rejects requests.
+func (p *fanOutTract) SetRejectOutput(out Output) {}
@@ -1,15 +1,40 @@
 package tract
 
-import "errors"
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"time"
+)
 
 // ErrFanOutAsHead is en error returned when a fanout group doesn't have its
 // input set. Aka htere should be another Tract feeding into it.
 var ErrFanOutAsHead = errors.New("fan out tract detected with no set input")
 
+// ErrRouterAsHead is an error returned when a router group doesn't have its
+// input set. Aka there should be another Tract feeding into it.
+var ErrRouterAsHead = errors.New("router tract detected with no set input")
+
 // ErrNoGroupMember is an error returned when a group tract doesn't have
 // enough members.
 var ErrNoGroupMember = errors.New("group tract detected with no inner tracts")
 
+// ErrShardNotSingleWorker is an error returned when a sharded group has an inner tract
+// that isn't a worker tract with a single worker.
+var ErrShardNotSingleWorker = errors.New("sharded group tract detected with an inner tract that is not a single worker")
+
+// deinitializer is implemented by tracts that need to close what Init made when they are not going to be started.
+type deinitializer interface {
+	deinit()
+}
+
+// deinit closes what the tract's Init made, without closing its outputs.
+func deinit(tract Tract) {
+	if d, ok := tract.(deinitializer); ok {
+		d.deinit()
+	}
+}
+
 // chain chains multiple Tracts together.
 // The result can collectively be viewed as a single larger tract.
 //
@@ -22,12 +47,27 @@ func chain(tracts ...Tract) {
 }
 
 // link links 2 Tracts together.
+// The link is buffered if toTract asks for an input buffer,
+// and drops requests when full if toTract asks for an overflow policy.
 //
 // ( fromTract ) -> ( toTract )
 func link(from, to Tract) {
-	link := make(chan Request)
-	from.SetOutput(OutputChannel(link))
-	to.SetInput(InputChannel(link))
+	link := make(chan Request, inputBufferSize(to))
+	from.SetOutput(linkOutput(to, link))
+	to.SetInput(linkInput{InputChannel: link})
+}
+
+// inputBufferer is implemented by tracts that specify how many requests the link to their input should hold.
+type inputBufferer interface {
+	inputBufferSize() int
+}
+
+// inputBufferSize gets the size of the buffer the tract wants on the link to its input.
+func inputBufferSize(tract Tract) int {
+	if b, ok := tract.(inputBufferer); ok {
+		return b.inputBufferSize()
+	}
+	return 0
 }
 
 // NewSerialGroupTract makes a new tract that consists muliple other tracts.
@@ -45,8 +85,9 @@ func NewSerialGroupTract(name string, tract Tract, tracts ...Tract) Tract {
 }
 
 type serialGroupTract struct {
-	name   string
-	tracts []Tract
+	name         string
+	tracts       []Tract
+	rejectOutput Output
 }
 
 func (p *serialGroupTract) Name() string {
@@ -60,27 +101,44 @@ func (p *serialGroupTract) Init() error {
 
 func (p *serialGroupTract) init() error {
 	if len(p.tracts) == 0 {
-		return ErrNoGroupMember
+		return &InitError{Path: p.name, Err: ErrNoGroupMember}
 	}
-	var err error
-	for _, tract := range p.tracts {
-		err = tract.Init()
+	for i, tract := range p.tracts {
+		err := tract.Init()
 		if err != nil {
-			return err
+			// Tear down the tracts already initialized, so nothing is left open.
+			for _, initializedTract := range p.tracts[:i] {
+				deinit(initializedTract)
+			}
+			return newGroupInitError(p.name, tract, err)
 		}
 	}
 	return nil
 }
 
+func (p *serialGroupTract) deinit() {
+	for _, tract := range p.tracts {
+		deinit(tract)
+	}
+}
+
 func (p *serialGroupTract) Start() func() {
+	return p.StartContext(context.Background())
+}
+
+func (p *serialGroupTract) StartContext(ctx context.Context) func() {
+	ctx = withTractPath(ctx, p.name)
 	callbacks := []func(){}
 	for i := len(p.tracts) - 1; i >= 0; i-- {
-		callbacks = append(callbacks, p.tracts[i].Start())
+		callbacks = append(callbacks, StartContext(ctx, p.tracts[i]))
 	}
 	return func() {
 		for i := len(callbacks) - 1; i >= 0; i-- {
 			callbacks[i]()
 		}
+		if p.rejectOutput != nil {
+			p.rejectOutput.Close()
+		}
 	}
 }
 
@@ -98,6 +156,27 @@ func (p *serialGroupTract) SetOutput(out Output) {
 	p.tracts[len(p.tracts)-1].SetOutput(out)
 }
 
+func (p *serialGroupTract) inputBufferSize() int {
+	if len(p.tracts) == 0 {
+		return 0
+	}
+	return inputBufferSize(p.tracts[0])
+}
+
+func (p *serialGroupTract) overflowPolicy() (OverflowPolicy, MetricsHandler) {
+	if len(p.tracts) == 0 {
+		return OverflowBlock, nil
+	}
+	return overflowPolicy(p.tracts[0])
+}
+
+func (p *serialGroupTract) SetRejectOutput(out Output) {
+	for _, tract := range p.tracts {
+		SetRejectOutput(tract, nonCloseOutput{Output: out})
+	}
+	p.rejectOutput = out
+}
+
 // NewParalellGroupTract makes a new tract that consists of muliple other tracts.
 // Each request this tract receives is routed to 1 of its inner tracts.
 // All requests proccessed by the inner tracts are routed to the same output.
@@ -126,7 +205,11 @@ func (p *paralellGroupTract) Init() error {
 }
 
 func (p *paralellGroupTract) Start() func() {
-	wait := p.serialGroupTract.Start()
+	return p.StartContext(context.Background())
+}
+
+func (p *paralellGroupTract) StartContext(ctx context.Context) func() {
+	wait := p.serialGroupTract.StartContext(ctx)
 	return func() {
 		wait()
 		p.output.Close()
@@ -142,6 +225,22 @@ func (p *paralellGroupTract) SetInput(in Input) {
 	}
 }
 
+// All inner tracts share the same input, so the link to it holds as much as the largest of them asks for.
+func (p *paralellGroupTract) inputBufferSize() int {
+	size := 0
+	for _, tract := range p.tracts {
+		if tractSize := inputBufferSize(tract); tractSize > size {
+			size = tractSize
+		}
+	}
+	return size
+}
+
+// All inner tracts share the same input, so the link to it always waits for room.
+func (p *paralellGroupTract) overflowPolicy() (OverflowPolicy, MetricsHandler) {
+	return OverflowBlock, nil
+}
+
 func (p *paralellGroupTract) SetOutput(out Output) {
 	if len(p.tracts) == 0 {
 		return
@@ -178,6 +277,47 @@ func NewFanOutGroupTract(name string, tract Tract, tracts ...Tract) Tract {
 	return fTract
 }
 
+// FanOutBranch is an inner tract of a conditional fan out group tract.
+type FanOutBranch struct {
+	// Tract is the inner tract.
+	Tract Tract
+	// Predicate decides if a request should be put to the inner tract.
+	// If it is nil, every request is put to the inner tract.
+	Predicate func(Request) bool
+}
+
+// NewConditionalFanOutGroupTract makes a new tract that consists muliple other tracts.
+// Each request this tract receives is routed to all of its inner tracts whose predicate it matches.
+// Requests that match no predicate are cleaned up as failed. The amount of inner tracts each request
+// is routed to is reported to @metricsHandler as a MetricsKeyBranches metric, if it is not nil.
+// All requests proccessed by the inner tracts are routed to the same output.
+// This Tract should not be the first tract in a group as it has no machanism
+// of closing on it's own. Aka it's input must be set to something.
+//     ------------------
+//     | / ( Tract0 ) \ |
+//  -> | - ( Tract1 ) - | ->
+//     | \ ( Tract2 ) / |
+//     |     ...        |
+//     ------------------
+func NewConditionalFanOutGroupTract(name string, metricsHandler MetricsHandler, branch FanOutBranch, branches ...FanOutBranch) Tract {
+	branches = append([]FanOutBranch{branch}, branches...)
+	fanOutTract := &fanOutTract{
+		input:          InputGenerator{},
+		predicates:     make([]func(Request) bool, len(branches)),
+		metricsHandler: metricsHandler,
+		name:           name,
+	}
+	fTract := &fanOutGroupTract{}
+	fTract.name = name
+	fTract.tracts = []Tract{fanOutTract}
+	for i, branch := range branches {
+		fanOutTract.predicates[i] = branch.Predicate
+		fTract.tracts = append(fTract.tracts, branch.Tract)
+	}
+	fTract.output = FinalOutput{}
+	return fTract
+}
+
 type fanOutGroupTract struct {
 	serialGroupTract
 	output Output
@@ -185,12 +325,13 @@ type fanOutGroupTract struct {
 
 func (p *fanOutGroupTract) Init() error {
 	if _, weAreHeadTract := p.tracts[0].(*fanOutTract).input.(InputGenerator); weAreHeadTract {
-		return ErrFanOutAsHead
+		return &InitError{Path: p.name, Err: ErrFanOutAsHead}
 	}
 	if len(p.tracts) <= 1 {
-		return ErrNoGroupMember
+		return &InitError{Path: p.name, Err: ErrNoGroupMember}
 	}
 	// Connect the fan out tract to all the other tracts.
+	p.tracts[0].(*fanOutTract).outputs = nil
 	for _, tract := range p.tracts[1:] {
 		link(p.tracts[0], tract)
 	}
@@ -198,7 +339,11 @@ func (p *fanOutGroupTract) Init() error {
 }
 
 func (p *fanOutGroupTract) Start() func() {
-	wait := p.serialGroupTract.Start()
+	return p.StartContext(context.Background())
+}
+
+func (p *fanOutGroupTract) StartContext(ctx context.Context) func() {
+	wait := p.serialGroupTract.StartContext(ctx)
 	return func() {
 		wait()
 		p.output.Close()
@@ -215,3 +360,185 @@ func (p *fanOutGroupTract) SetOutput(out Output) {
 	}
 	p.output = out
 }
+
+// NewRouterGroupTract makes a new tract that consists muliple other tracts.
+// Each request this tract receives is routed to exactly 1 of its inner tracts, chosen by @route.
+// @route returns the index of the inner tract in @tracts to route the request to. Requests it
+// returns an index outside of @tracts for are routed to @defaultTract.
+// All requests proccessed by the inner tracts are routed to the same output.
+// This Tract should not be the first tract in a group as it has no machanism
+// of closing on it's own. Aka it's input must be set to something.
+//     ------------------------
+//     | / ( Tract0 )       \ |
+//  -> | - ( Tract1 )       - | ->
+//     | \ ( DefaultTract ) / |
+//     ------------------------
+func NewRouterGroupTract(name string, route func(Request) int, defaultTract Tract, tracts ...Tract) Tract {
+	// Copy @tracts so the default tract isn't written into the caller's slice.
+	tracts = append(append(make([]Tract, 0, len(tracts)+1), tracts...), defaultTract)
+	return newRouterGroupTract(name, route, tracts)
+}
+
+// newRouterGroupTract makes a router group tract routing to @tracts, where the last tract is the default tract.
+func newRouterGroupTract(name string, route func(Request) int, tracts []Tract) *routerGroupTract {
+	routerTract := &routerTract{
+		input: InputGenerator{},
+		route: route,
+	}
+	rTract := &routerGroupTract{}
+	rTract.name = name
+	rTract.tracts = append([]Tract{routerTract}, tracts...)
+	rTract.output = FinalOutput{}
+	return rTract
+}
+
+type routerGroupTract struct {
+	fanOutGroupTract
+	// Set if each inner tract must be a single worker, as in a sharded group
+	singleWorkers bool
+}
+
+func (p *routerGroupTract) Init() error {
+	if _, weAreHeadTract := p.tracts[0].(*routerTract).input.(InputGenerator); weAreHeadTract {
+		return &InitError{Path: p.name, Err: ErrRouterAsHead}
+	}
+	if p.singleWorkers {
+		for _, tract := range p.tracts[1:] {
+			if !isSingleWorker(tract) {
+				return newGroupInitError(p.name, tract, ErrShardNotSingleWorker)
+			}
+		}
+	}
+	// Connect the router tract to all the other tracts, in the order it routes to them.
+	p.tracts[0].(*routerTract).outputs = nil
+	for _, tract := range p.tracts[1:] {
+		link(p.tracts[0], tract)
+	}
+	return p.init()
+}
+
+// NewShardedGroupTract makes a new tract that consists muliple other tracts.
+// Each request this tract receives is routed to 1 of its inner tracts, chosen by hashing the key
+// @key gets from the request. All requests with the same key are routed to the same inner tract,
+// in the order this tract received them. To keep requests with the same key from being worked
+// concurrently or out of order, the inner tracts must each be a worker tract or batch tract with a single worker,
+// or the tract fails to initialize with ErrShardNotSingleWorker.
+// All requests proccessed by the inner tracts are routed to the same output.
+// This Tract should not be the first tract in a group as it has no machanism
+// of closing on it's own. Aka it's input must be set to something.
+//     ------------------
+//     | / ( Tract0 ) \ |
+//  -> | - ( Tract1 ) - | ->
+//     | \ ( Tract2 ) / |
+//     |     ...        |
+//     ------------------
+func NewShardedGroupTract(name string, key func(Request) string, tract Tract, tracts ...Tract) Tract {
+	tracts = append([]Tract{tract}, tracts...)
+	shards := uint32(len(tracts))
+	rTract := newRouterGroupTract(name, func(r Request) int {
+		hash := fnv.New32a()
+		hash.Write([]byte(key(r)))
+		return int(hash.Sum32() % shards)
+	}, tracts)
+	rTract.singleWorkers = true
+	return rTract
+}
+
+// isSingleWorker checks if @tract never works more than one request at a time.
+func isSingleWorker(tract Tract) bool {
+	switch tract := tract.(type) {
+	case *workerTract:
+		return tract.singleWorker()
+	case *batchTract:
+		return tract.singleWorker()
+	default:
+		return false
+	}
+}
+
+// NewFanOutJoinGroupTract makes a new tract that consists muliple other tracts.
+// Each request this tract receives is copied to all of its inner tracts, like a fan out group tract.
+// Once every inner tract has finished its copy, or @timeout has elapsed since the request was received,
+// the copies are joined back into a single request by @merge. @merge is given the request this tract
+// received, and a BranchResult for each inner tract in order, reporting which copies succeeded and which
+// failed or timed out. It returns the merged request to output, and false if the merged request should be
+// discarded. The merged request should be derived from the request received, which keeps its cleanups;
+// the copies only run the cleanups added by the inner tracts. A timeout that is not positive waits for
+// every inner tract. Requests the inner tracts reject are reported to @merge instead of the reject output.
+// This Tract should not be the first tract in a group as it has no machanism
+// of closing on it's own. Aka it's input must be set to something.
+//     ----------------------------
+//     | / ( Tract0 ) \           |
+//  -> | - ( Tract1 ) - ( merge ) | ->
+//     | \ ( Tract2 ) /           |
+//     |     ...                  |
+//     ----------------------------
+func NewFanOutJoinGroupTract(name string, merge func(Request, []BranchResult) (Request, bool), timeout time.Duration, tract Tract, tracts ...Tract) Tract {
+	tracts = append([]Tract{tract}, tracts...)
+	fanOutJoinTract := &fanOutJoinTract{
+		name:    name,
+		input:   InputGenerator{},
+		output:  FinalOutput{},
+		merge:   merge,
+		timeout: timeout,
+	}
+	jTract := &fanOutJoinGroupTract{}
+	jTract.name = name
+	jTract.tracts = append(
+		[]Tract{fanOutJoinTract},
+		tracts...,
+	)
+	return jTract
+}
+
+type fanOutJoinGroupTract struct {
+	serialGroupTract
+}
+
+func (p *fanOutJoinGroupTract) fanOutJoinTract() *fanOutJoinTract {
+	return p.tracts[0].(*fanOutJoinTract)
+}
+
+func (p *fanOutJoinGroupTract) Init() error {
+	if _, weAreHeadTract := p.fanOutJoinTract().input.(InputGenerator); weAreHeadTract {
+		return &InitError{Path: p.name, Err: ErrFanOutAsHead}
+	}
+	if len(p.tracts) <= 1 {
+		return &InitError{Path: p.name, Err: ErrNoGroupMember}
+	}
+	// Connect the fan out join tract to all the other tracts, in the order their results are merged.
+	p.fanOutJoinTract().outputs = nil
+	for _, tract := range p.tracts[1:] {
+		link(p.tracts[0], tract)
+		tract.SetOutput(joinOutput{success: true})
+		// Tracts that can't output rejected requests still report them to the join when cleaning them up.
+		SetRejectOutput(tract, joinOutput{success: false})
+	}
+	return p.init()
+}
+
+func (p *fanOutJoinGroupTract) Start() func() {
+	return p.StartContext(context.Background())
+}
+
+func (p *fanOutJoinGroupTract) StartContext(ctx context.Context) func() {
+	wait := p.serialGroupTract.StartContext(ctx)
+	return func() {
+		wait()
+		// Wait for the requests still joining before closing the outputs they will be merged to.
+		fanOutJoinTract := p.fanOutJoinTract()
+		fanOutJoinTract.pending.Wait()
+		fanOutJoinTract.output.Close()
+		if fanOutJoinTract.rejectOutput != nil {
+			fanOutJoinTract.rejectOutput.Close()
+		}
+	}
+}
+
+func (p *fanOutJoinGroupTract) SetOutput(out Output) {
+	p.fanOutJoinTract().output = out
+}
+
+func (p *fanOutJoinGroupTract) SetRejectOutput(out Output) {
+	p.fanOutJoinTract().rejectOutput = out
+}
@@ -0,0 +1,147 @@
+package tract
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestLinkInputBuffer(t *testing.T) {
+	factory := NewFactoryFromWorker(testWorker{})
+	tests := []struct {
+		name         string
+		to           Tract
+		expectedSize int
+	}{
+		{
+			name:         "unbuffered",
+			to:           NewWorkerTract("to", 1, factory),
+			expectedSize: 0,
+		},
+		{
+			name:         "worker",
+			to:           NewWorkerTract("to", 1, factory, WithInputBuffer(3)),
+			expectedSize: 3,
+		},
+		{
+			name: "serial",
+			to: NewSerialGroupTract("to",
+				NewWorkerTract("first", 1, factory, WithInputBuffer(3)),
+				NewWorkerTract("second", 1, factory, WithInputBuffer(5)),
+			),
+			expectedSize: 3,
+		},
+		{
+			name: "paralell",
+			to: NewParalellGroupTract("to",
+				NewWorkerTract("first", 1, factory, WithInputBuffer(3)),
+				NewWorkerTract("second", 1, factory, WithInputBuffer(5)),
+			),
+			expectedSize: 5,
+		},
+	}
+	for _, test := range tests {
+		from := NewWorkerTract("from", 1, factory)
+		link(from, test.to)
+		linkOutput, _ := from.(*workerTract).output.(OutputChannel)
+		if size := cap(linkOutput); size != test.expectedSize {
+			t.Errorf("%s: link buffer size: expected %d, received %d", test.name, test.expectedSize, size)
+		}
+	}
+}
+
+func TestLinkOverflowPolicy(t *testing.T) {
+	type testLabel struct{}
+	tests := []struct {
+		name            string
+		policy          OverflowPolicy
+		buffer          int
+		expectedLabels  []int
+		expectedDropped int
+	}{
+		{
+			name:            "drop oldest",
+			policy:          OverflowDropOldest,
+			buffer:          2,
+			expectedLabels:  []int{2, 3},
+			expectedDropped: 2,
+		},
+		{
+			name:            "drop newest",
+			policy:          OverflowDropNewest,
+			buffer:          2,
+			expectedLabels:  []int{0, 1},
+			expectedDropped: 2,
+		},
+		{
+			// Without a buffer there is no oldest request to drop, so the request being put is dropped.
+			name:            "drop oldest unbuffered",
+			policy:          OverflowDropOldest,
+			expectedDropped: 4,
+		},
+	}
+	for _, test := range tests {
+		metricsChannel := make(chan Metric, 4)
+		from := NewWorkerTract("from", 1, NewFactoryFromWorker(testWorker{}))
+		to := NewWorkerTract("to", 1, NewFactoryFromWorker(testWorker{}),
+			WithInputBuffer(test.buffer),
+			WithOverflowPolicy(test.policy),
+			WithMetricsHandler(testMetricHandler{metricsChannel: metricsChannel}),
+		)
+		link(from, to)
+
+		var droppedLabels []int
+		out := from.(*workerTract).output
+		for label := 0; label < 4; label++ {
+			r := context.WithValue(context.Background(), testLabel{}, label)
+			out.Put(AddRequestCleanup(r, func(r Request, success bool) {
+				if success {
+					t.Errorf("%s: unexpected successful cleanup", test.name)
+				}
+				label, _ := r.Value(testLabel{}).(int)
+				droppedLabels = append(droppedLabels, label)
+			}))
+		}
+		out.Close()
+
+		var labels []int
+		for {
+			r, ok := to.(*workerTract).input.Get()
+			if !ok {
+				break
+			}
+			label, _ := r.Value(testLabel{}).(int)
+			labels = append(labels, label)
+		}
+		if !reflect.DeepEqual(labels, test.expectedLabels) {
+			t.Errorf("%s: linked requests: expected %v, received %v", test.name, test.expectedLabels, labels)
+		}
+		if len(droppedLabels) != test.expectedDropped {
+			t.Errorf("%s: dropped requests: expected %d, received %v", test.name, test.expectedDropped, droppedLabels)
+		}
+		close(metricsChannel)
+		var dropped int64
+		for metric := range metricsChannel {
+			if metric.Key == MetricsKeyDropped {
+				dropped += metric.Count
+			}
+		}
+		if dropped != int64(test.expectedDropped) {
+			t.Errorf("%s: dropped metrics: expected %d, received %d", test.name, test.expectedDropped, dropped)
+		}
+	}
+}
+
+func TestNewRouterGroupTractCallerTracts(t *testing.T) {
+	var (
+		tract0       = NewWorkerTract("tract0", 1, nil)
+		spare        = NewWorkerTract("spare", 1, nil)
+		defaultTract = NewWorkerTract("default", 1, nil)
+	)
+	// The caller's slice has spare capacity past the tracts passed in.
+	tracts := []Tract{tract0, spare}
+	NewRouterGroupTract("router", func(Request) int { return 0 }, defaultTract, tracts[:1]...)
+	if tracts[1] != spare {
+		t.Errorf("caller's tracts: expected %q after the tracts passed in, received %q", spare.Name(), tracts[1].Name())
+	}
+}
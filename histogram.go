@@ -0,0 +1,197 @@
+package tract
+
+import (
+	"math/bits"
+	"sort"
+	"sync"
+	"time"
+)
+
+var _ MetricsHandler = &HistogramMetricsHandler{}
+
+// histogramKeys are the metrics a HistogramMetricsHandler aggregates: the ones that measure a latency.
+var histogramKeys = map[MetricsKey]bool{
+	MetricsKeyIn:        true,
+	MetricsKeyDuring:    true,
+	MetricsKeyOut:       true,
+	MetricsKeyTract:     true,
+	MetricsKeyError:     true,
+	MetricsKeyAttempt:   true,
+	MetricsKeyRateLimit: true,
+	MetricsKeyPanic:     true,
+}
+
+// NewHistogramMetricsHandler makes a HistogramMetricsHandler that handles the metrics @throttler decides to.
+func NewHistogramMetricsHandler(throttler DefaultMetricsThrottler) *HistogramMetricsHandler {
+	return &HistogramMetricsHandler{
+		DefaultMetricsThrottler: throttler,
+		histograms:              map[histogramLabels]*latencyHistogram{},
+	}
+}
+
+// HistogramMetricsHandler is a MetricsHandler that aggregates latency metrics into a streaming histogram for
+// each metrics key and tract, and reports their quantiles on demand. Histograms keep latencies to within 1%,
+// using memory that grows with the logarithm of the largest latency rather than with the amount of metrics.
+// It can be shared by many tracts.
+type HistogramMetricsHandler struct {
+	DefaultMetricsThrottler
+	mutex      sync.Mutex
+	histograms map[histogramLabels]*latencyHistogram
+}
+
+type histogramLabels struct {
+	// Tracts with the same name in different groups are told apart by their path, when it is set.
+	path  string
+	tract string
+	key   MetricsKey
+}
+
+// LatencySnapshot is the state of the histogram of one metrics key for one tract.
+type LatencySnapshot struct {
+	Tract string
+	// Path is the path of the tract, or empty if the metrics had no path.
+	Path string
+	Key  MetricsKey
+	// Count is the amount of metrics in the histogram.
+	Count uint64
+	P50   time.Duration
+	P90   time.Duration
+	P99   time.Duration
+	Max   time.Duration
+}
+
+// HandleMetrics adds the latency metrics to their histograms.
+func (h *HistogramMetricsHandler) HandleMetrics(metrics ...Metric) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for _, metric := range metrics {
+		if !histogramKeys[metric.Key] {
+			continue
+		}
+		labels := histogramLabels{path: metric.Path, tract: metric.Tract, key: metric.Key}
+		histogram, ok := h.histograms[labels]
+		if !ok {
+			histogram = &latencyHistogram{}
+			h.histograms[labels] = histogram
+		}
+		histogram.record(metric.Value)
+	}
+}
+
+// Snapshot reports every histogram, sorted by tract path, then by tract, and then by metrics key.
+func (h *HistogramMetricsHandler) Snapshot() []LatencySnapshot {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.snapshot()
+}
+
+// Reset reports every histogram like Snapshot, then empties them, so the next snapshot
+// only covers the metrics handled after the reset.
+func (h *HistogramMetricsHandler) Reset() []LatencySnapshot {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	snapshots := h.snapshot()
+	h.histograms = map[histogramLabels]*latencyHistogram{}
+	return snapshots
+}
+
+func (h *HistogramMetricsHandler) snapshot() []LatencySnapshot {
+	snapshots := make([]LatencySnapshot, 0, len(h.histograms))
+	for labels, histogram := range h.histograms {
+		snapshots = append(snapshots, LatencySnapshot{
+			Tract: labels.tract,
+			Path:  labels.path,
+			Key:   labels.key,
+			Count: histogram.count,
+			P50:   histogram.quantile(0.5),
+			P90:   histogram.quantile(0.9),
+			P99:   histogram.quantile(0.99),
+			Max:   histogram.max,
+		})
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		if snapshots[i].Path != snapshots[j].Path {
+			return snapshots[i].Path < snapshots[j].Path
+		}
+		if snapshots[i].Tract != snapshots[j].Tract {
+			return snapshots[i].Tract < snapshots[j].Tract
+		}
+		return snapshots[i].Key < snapshots[j].Key
+	})
+	return snapshots
+}
+
+// histogramPrecision is the amount of significant bits latencies are kept to.
+// Each power of two range of latencies is split into 2^(histogramPrecision-1) buckets.
+const histogramPrecision = 8
+
+// latencyHistogram is a log-linear histogram of latencies in nanoseconds, in the style of an HDR histogram.
+// Latencies below 2^histogramPrecision nanoseconds each have their own bucket, and larger latencies
+// share buckets whose width is under 1% of the latencies in them.
+type latencyHistogram struct {
+	// Amount of latencies in each bucket, only as long as the highest bucket used.
+	buckets []uint64
+	count   uint64
+	max     time.Duration
+}
+
+func (h *latencyHistogram) record(latency time.Duration) {
+	if latency < 0 {
+		latency = 0
+	}
+	i := histogramIndex(uint64(latency))
+	if i >= len(h.buckets) {
+		h.buckets = append(h.buckets, make([]uint64, i+1-len(h.buckets))...)
+	}
+	h.buckets[i]++
+	h.count++
+	if latency > h.max {
+		h.max = latency
+	}
+}
+
+// quantile gets the latency that the @q fraction of latencies are at or below.
+func (h *latencyHistogram) quantile(q float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	rank := uint64(q * float64(h.count))
+	if float64(rank) < q*float64(h.count) || rank == 0 {
+		rank++
+	}
+	var cumulative uint64
+	for i, count := range h.buckets {
+		cumulative += count
+		if cumulative >= rank {
+			if latency := time.Duration(histogramUpperBound(i)); latency < h.max {
+				return latency
+			}
+			return h.max
+		}
+	}
+	return h.max
+}
+
+// histogramIndex gets the index of the bucket for a latency of @v nanoseconds.
+func histogramIndex(v uint64) int {
+	const linear = 1 << histogramPrecision
+	if v < linear {
+		return int(v)
+	}
+	// Keep only the highest histogramPrecision bits, the first of which is always set.
+	shift := bits.Len64(v) - histogramPrecision
+	top := v >> uint(shift)
+	return linear + (shift-1)*(linear/2) + int(top-linear/2)
+}
+
+// histogramUpperBound gets the largest latency in nanoseconds that goes in the bucket at index @i.
+func histogramUpperBound(i int) uint64 {
+	const linear = 1 << histogramPrecision
+	if i < linear {
+		return uint64(i)
+	}
+	i -= linear
+	shift := uint(i/(linear/2) + 1)
+	top := uint64(i%(linear/2) + linear/2)
+	return (top+1)<<shift - 1
+}
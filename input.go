@@ -15,6 +15,8 @@ var (
 	_ Input = InputChannel(nil)
 	_ Input = InputGenerator{}
 	_ Input = MetricsInput{}
+	_ Input = linkInput{}
+	_ Input = contextInput{}
 )
 
 // InputChannel is a channel of requests.
@@ -26,6 +28,15 @@ func (c InputChannel) Get() (Request, bool) {
 	return request, ok
 }
 
+func (c InputChannel) buffer() (length, capacity int) {
+	return len(c), cap(c)
+}
+
+// bufferedInput is an Input that can report how many requests are waiting in it.
+type bufferedInput interface {
+	buffer() (length, capacity int)
+}
+
 // InputGenerator generates request objects.
 // It is the default input of a Tract.
 type InputGenerator struct{}
@@ -50,14 +61,114 @@ func (i MetricsInput) Get() (Request, bool) {
 		ok      bool
 	)
 	if i.metricsHandler != nil && i.metricsHandler.ShouldHandle() {
+		bufferLength, bufferCapacity := inputBuffer(i.Input)
 		before := now()
 		request, ok = i.Input.Get()
 		after := now()
-		i.metricsHandler.HandleMetrics(
-			Metric{MetricsKeyIn, after.Sub(before)},
-		)
+		if bufferCapacity > 0 {
+			i.metricsHandler.HandleMetrics(
+				Metric{Key: MetricsKeyIn, Value: after.Sub(before)},
+				Metric{Key: MetricsKeyInBuffer, Count: int64(bufferLength)},
+			)
+		} else {
+			i.metricsHandler.HandleMetrics(
+				Metric{Key: MetricsKeyIn, Value: after.Sub(before)},
+			)
+		}
 	} else {
 		request, ok = i.Input.Get()
 	}
 	return request, ok
 }
+
+// inputBuffer gets the amount of requests waiting in an input, and how many it can hold.
+// Both are zero for unbuffered inputs.
+func inputBuffer(in Input) (length, capacity int) {
+	if b, ok := in.(bufferedInput); ok {
+		return b.buffer()
+	}
+	return 0, 0
+}
+
+// linkInput is the input side of a link between two tracts within a group.
+// It is kept distinct from a user provided InputChannel so that a cancelled tract
+// keeps draining requests already in flight from the tracts before it.
+type linkInput struct {
+	InputChannel
+}
+
+// InterruptibleInput is an Input that can stop waiting for its next request.
+// Tracts started with StartContext or StartDrainable get requests from it with GetContext, so they stop waiting
+// on it once they are cancelled or drained. Inputs that are neither channels nor interruptible are only checked
+// between requests: a tract waiting on one stops once it gets its next request, or the input has no more requests.
+type InterruptibleInput interface {
+	Input
+	// GetContext gets the next request like Get, but stops waiting once @ctx is done, returning false.
+	// No request should be taken from the input once @ctx is done.
+	GetContext(ctx context.Context) (Request, bool)
+}
+
+// contextInput is a wrapper around an Input that stops getting requests once its context is done,
+// or once the tract is being drained, even while waiting on the input if it is a channel or interruptible.
+// Inputs linking tracts within a group are never interrupted; the tract before it will close the link.
+// Neither are the inputs of batch tracts, which are closed once the input they collect from is finished.
+type contextInput struct {
+	Input
+	ctx context.Context
+}
+
+func (i contextInput) buffer() (length, capacity int) {
+	return inputBuffer(i.Input)
+}
+
+// Get gets from the inner input unless the context is done, or the tract is draining.
+func (i contextInput) Get() (Request, bool) {
+	switch input := i.Input.(type) {
+	case linkInput:
+		return input.Get()
+	case *batchInput:
+		return input.Get()
+	}
+	drain := getDrainState(i.ctx)
+	request, ok := i.get(drain)
+	if !ok {
+		return nil, false
+	}
+	return drain.track(request), true
+}
+
+func (i contextInput) get(drain *drainState) (Request, bool) {
+	stopped := drain.stopped()
+	if i.interrupted(stopped) {
+		return nil, false
+	}
+	switch input := i.Input.(type) {
+	case InputGenerator:
+		return setRequestStartTime(i.ctx, now()), true
+	case InputChannel:
+		select {
+		case request, ok := <-input:
+			return request, ok
+		case <-i.ctx.Done():
+			return nil, false
+		case <-stopped:
+			return nil, false
+		}
+	case InterruptibleInput:
+		return input.GetContext(drain.context(i.ctx))
+	default:
+		return input.Get()
+	}
+}
+
+// interrupted checks if the input should stop getting requests.
+func (i contextInput) interrupted(stopped <-chan struct{}) bool {
+	select {
+	case <-i.ctx.Done():
+		return true
+	case <-stopped:
+		return true
+	default:
+		return false
+	}
+}
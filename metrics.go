@@ -1,14 +1,28 @@
 package tract
 
-import "time"
+import (
+	"context"
+	"time"
+)
 
 // test overridable time.Now function used for metrics gathering
 var now = time.Now
 
 // Metric is a tuple of a metric time latency and a key specifying what the metric is measuring.
+// Metrics that measure an amount of something rather than a latency store it in Count instead of Value.
 type Metric struct {
 	Key   MetricsKey
 	Value time.Duration
+	Count int64
+	// Tract is the name of the tract that produced the metric.
+	Tract string
+	// Path is the names of the groups the tract that produced the metric is in, from the outermost
+	// group down to the tract itself, joined by slashes, such as "pipeline/enrich/parse".
+	Path string
+	// Worker is the number of the worker within its tract that produced the metric, counting from 1,
+	// or 0 if the metric was not produced by a worker, such as metrics about a tract as a whole,
+	// or metrics not produced by a tract.
+	Worker int
 }
 
 // MetricsKey is an enum key that specifies a kind of metric
@@ -24,6 +38,50 @@ const (
 	// MetricsKeyTract specifiies metric for the amount of time from when a request was generated,
 	// until it hit the end of the tract (was outputted from a tract that had no user specified output).
 	MetricsKeyTract
+	// MetricsKeyError specifiies metric for the amount of time a tract spent waiting for its worker to fail a request with an error.
+	// Each of these metrics represents one failed request. The error can be retrieved from the request using GetRequestError().
+	MetricsKeyError
+	// MetricsKeyAttempt specifiies metric for the amount of time a tract spent waiting for its worker to make a single attempt
+	// at processing a request when retrying. MetricsKeyDuring still measures all attempts for the request together.
+	MetricsKeyAttempt
+	// MetricsKeyInBuffer specifiies metric for the amount of requests waiting in a tract's buffered input
+	// when the tract went to get its next request. This metric uses Count instead of Value.
+	MetricsKeyInBuffer
+	// MetricsKeyRateLimit specifiies metric for the amount of time a rate limited tract spent waiting to be allowed to process a request.
+	MetricsKeyRateLimit
+	// MetricsKeyBranches specifiies metric for the amount of inner tracts a conditional fan out group tract
+	// put a request to. This metric uses Count instead of Value.
+	MetricsKeyBranches
+	// MetricsKeyDropped specifiies metric for the amount of requests dropped from, or not put to, a tract's full
+	// input buffer by its overflow policy since the last of these metrics. This metric uses Count instead of Value.
+	MetricsKeyDropped
+	// MetricsKeyCircuitState specifiies metric for the state a circuit breaker changed to, as a CircuitState.
+	// This metric uses Count instead of Value.
+	MetricsKeyCircuitState
+	// MetricsKeyPanic specifiies metric for the amount of time a tract spent waiting for its worker to work a request
+	// before the worker panicked. Each of these metrics represents one request failed with a PanicError.
+	MetricsKeyPanic
+	// MetricsKeyReceived specifiies metric for the amount of requests a tract got from its input since the last
+	// of these metrics. Head tracts count the requests their workers generated instead. This metric uses Count instead of Value.
+	MetricsKeyReceived
+	// MetricsKeyCompleted specifiies metric for the amount of requests a tract outputted since the last of these metrics.
+	// This metric uses Count instead of Value.
+	MetricsKeyCompleted
+	// MetricsKeyRejected specifiies metric for the amount of requests a tract did not output, without an error,
+	// since the last of these metrics. This metric uses Count instead of Value.
+	MetricsKeyRejected
+	// MetricsKeyFailed specifiies metric for the amount of requests a tract did not output because they failed with
+	// an error, or were drained without being worked after the tract was cancelled, since the last of these metrics.
+	// This metric uses Count instead of Value.
+	MetricsKeyFailed
+	// MetricsKeyInFlight specifiies metric for the amount of requests a tract has gotten from its input,
+	// but not outputted or rejected yet. This metric uses Count instead of Value.
+	MetricsKeyInFlight
+	// MetricsKeyWorkers specifiies metric for the amount of workers a tract has. This metric uses Count instead of Value.
+	MetricsKeyWorkers
+	// MetricsKeyBusyWorkers specifiies metric for the amount of a tract's workers that are working a request.
+	// Divided by MetricsKeyWorkers, it is the tract's worker utilization. This metric uses Count instead of Value.
+	MetricsKeyBusyWorkers
 )
 
 // MetricsHandler handles metrics that a tract produces.
@@ -38,54 +96,69 @@ type MetricsHandler interface {
 	ShouldHandle() bool
 }
 
-// NewDefaultMetricsThrottler makes a DefaultMetricsThrottle ready to use
-func NewDefaultMetricsThrottler(frequency time.Duration) DefaultMetricsThrottler {
-	throttler := DefaultMetricsThrottler{
-		frequency: frequency,
-	}
-	if frequency > 0 {
-		throttler.timer = time.NewTimer(frequency)
-	}
-	return throttler
-}
+var (
+	_ MetricsHandler = composeDefaultMetricsThrottlerMetricsHandler{}
+	_ MetricsHandler = &composeDefaultMetricsThrottlerMetricsHandler{}
+	_ MetricsHandler = &manualOverrideMetricsHandler{}
+	_ MetricsHandler = tractMetricsHandler{}
+)
 
-// DefaultMetricsThrottler is a provided implementation of ShouldHandle()
-// that can be composed into any struct trying to implement a MetricsHandler.
-type DefaultMetricsThrottler struct {
-	frequency time.Duration
-	timer     *time.Timer
+// tractMetricsHandler is a wrapper around a MetricsHandler that labels metrics with the tract and worker that produced them.
+type tractMetricsHandler struct {
+	MetricsHandler
+	tract string
+	path  string
+	// Number of the worker, counting from 1, or 0 for metrics not produced by a worker
+	worker int
 }
 
-// ShouldHandle determines when we should handle metrics based off a frequency
-//  Frequency |            ShouldHandle() logic
-//  --------------------------------------------
-//          0 |                   Always handle
-//        < 0 |                    Never handle
-//        > 0 | Handle once per frequency cycle
-func (d DefaultMetricsThrottler) ShouldHandle() bool {
-	// Default/Edge case when frequency is zero, we should always handle
-	if d.frequency == 0 {
-		return true
+// newTractMetricsHandler wraps @mh to label metrics with the name and path of @tract, and the worker at index @worker
+// of the tract's workers, or no worker if it is -1, unless it is nil.
+func newTractMetricsHandler(mh MetricsHandler, tract, path string, worker int) MetricsHandler {
+	if mh == nil {
+		return nil
 	}
-	// Timer is nil if frequency is negative (never should handle)
-	if d.timer == nil {
-		return false
+	return tractMetricsHandler{
+		MetricsHandler: mh,
+		tract:          tract,
+		path:           path,
+		worker:         worker + 1,
 	}
-	shouldHandle := false
-	select {
-	case <-d.timer.C:
-		shouldHandle = true
-		d.timer.Reset(d.frequency)
-	default:
+}
+
+// HandleMetrics labels the metrics, and passes them to the inner MetricsHandler.
+func (h tractMetricsHandler) HandleMetrics(metrics ...Metric) {
+	for i := range metrics {
+		if metrics[i].Tract == "" {
+			metrics[i].Tract = h.tract
+			metrics[i].Path = h.path
+			metrics[i].Worker = h.worker
+		}
 	}
-	return shouldHandle
+	h.MetricsHandler.HandleMetrics(metrics...)
 }
 
-var (
-	_ MetricsHandler = composeDefaultMetricsThrottlerMetricsHandler{}
-	_ MetricsHandler = &composeDefaultMetricsThrottlerMetricsHandler{}
-	_ MetricsHandler = &manualOverrideMetricsHandler{}
-)
+// tractPathKey is the key to retreive the path of the group a tract is started in from the context it is started with.
+// Context value type is string
+type tractPathKey struct{}
+
+// tractPath gets the path of the group a tract is started in, or an empty string if it is not started in a group.
+func tractPath(ctx context.Context) string {
+	path, _ := ctx.Value(tractPathKey{}).(string)
+	return path
+}
+
+// withTractPath adds a tract named @name to the path in @ctx, for starting the tracts within it.
+func withTractPath(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, tractPathKey{}, joinTractPath(tractPath(ctx), name))
+}
+
+func joinTractPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "/" + name
+}
 
 type manualOverrideMetricsHandler struct {
 	MetricsHandler
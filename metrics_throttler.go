@@ -0,0 +1,130 @@
+package tract
+
+import (
+	"math"
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+// NewDefaultMetricsThrottler makes a DefaultMetricsThrottler that handles metrics once per @frequency.
+//
+//	Frequency |            ShouldHandle() logic
+//	--------------------------------------------
+//	        0 |                   Always handle
+//	      < 0 |                    Never handle
+//	      > 0 | Handle once per frequency cycle
+func NewDefaultMetricsThrottler(frequency time.Duration) DefaultMetricsThrottler {
+	switch {
+	case frequency == 0:
+		return DefaultMetricsThrottler{}
+	case frequency < 0:
+		return DefaultMetricsThrottler{sampler: neverSampler{}}
+	}
+	return DefaultMetricsThrottler{sampler: &windowSampler{
+		start:     time.Now(),
+		frequency: int64(frequency),
+		next:      int64(frequency),
+	}}
+}
+
+// NewEveryNMetricsThrottler makes a DefaultMetricsThrottler that handles metrics for every @n requests.
+//
+//	        N |            ShouldHandle() logic
+//	--------------------------------------------
+//	        1 |                   Always handle
+//	     <= 0 |                    Never handle
+//	      > 1 |       Handle once per N requests
+func NewEveryNMetricsThrottler(n int) DefaultMetricsThrottler {
+	switch {
+	case n == 1:
+		return DefaultMetricsThrottler{}
+	case n <= 0:
+		return DefaultMetricsThrottler{sampler: neverSampler{}}
+	}
+	return DefaultMetricsThrottler{sampler: &everyNSampler{n: uint64(n)}}
+}
+
+// NewProbabilisticMetricsThrottler makes a DefaultMetricsThrottler that handles metrics for each request
+// with a probability of @rate.
+//
+//	     Rate |            ShouldHandle() logic
+//	--------------------------------------------
+//	     >= 1 |                   Always handle
+//	     <= 0 |                    Never handle
+//	   0 to 1 |    Handle that rate of requests
+func NewProbabilisticMetricsThrottler(rate float64) DefaultMetricsThrottler {
+	switch {
+	case rate >= 1:
+		return DefaultMetricsThrottler{}
+	case rate <= 0 || math.IsNaN(rate):
+		return DefaultMetricsThrottler{sampler: neverSampler{}}
+	}
+	return DefaultMetricsThrottler{sampler: probabilisticSampler{threshold: int64(rate * (1 << 63))}}
+}
+
+// DefaultMetricsThrottler is a provided implementation of ShouldHandle()
+// that can be composed into any struct trying to implement a MetricsHandler.
+// Copies of a DefaultMetricsThrottler share their throttling, so one throttler is safe to use
+// from every worker of every tract it is given to. The zero value always handles metrics.
+type DefaultMetricsThrottler struct {
+	sampler metricsSampler
+}
+
+// ShouldHandle determines when we should handle metrics based off the throttler's strategy.
+func (d DefaultMetricsThrottler) ShouldHandle() bool {
+	if d.sampler == nil {
+		return true
+	}
+	return d.sampler.sample()
+}
+
+// metricsSampler decides which requests metrics are handled for.
+// Implementations must be safe for concurrent use without locking, as they are called for every request.
+type metricsSampler interface {
+	sample() bool
+}
+
+type neverSampler struct{}
+
+func (neverSampler) sample() bool { return false }
+
+// windowSampler samples the first request after each window of time.
+// The atomic fields are first to keep them 64-bit aligned on 32-bit platforms.
+type windowSampler struct {
+	// Nanoseconds since start when the next window begins
+	next int64
+	// Length of each window in nanoseconds
+	frequency int64
+	start     time.Time
+}
+
+func (s *windowSampler) sample() bool {
+	elapsed := int64(time.Since(s.start))
+	next := atomic.LoadInt64(&s.next)
+	if elapsed < next {
+		return false
+	}
+	// Only one of the requests racing for this window wins it.
+	return atomic.CompareAndSwapInt64(&s.next, next, elapsed+s.frequency)
+}
+
+// everyNSampler samples one of every n requests.
+type everyNSampler struct {
+	count uint64
+	n     uint64
+}
+
+func (s *everyNSampler) sample() bool {
+	return atomic.AddUint64(&s.count, 1)%s.n == 0
+}
+
+// probabilisticSampler samples each request when a random non-negative int64 falls below its threshold.
+type probabilisticSampler struct {
+	threshold int64
+}
+
+func (s probabilisticSampler) sample() bool {
+	// The top level math/rand functions are safe for concurrent use without a shared lock.
+	return rand.Int63() < s.threshold
+}
@@ -0,0 +1,95 @@
+package tract
+
+import "sync"
+
+// sequencer numbers requests as a worker tract gets them from its input, and
+// puts them to the tract's output in that same order.
+type sequencer struct {
+	// Maximum amount of requests that can be between the oldest request not yet outputted and the newest request gotten.
+	window uint64
+
+	// Serializes getting requests from the input with numbering them.
+	getMutex sync.Mutex
+
+	mutex sync.Mutex
+	// Signals when requests have been outputted, making room in the window.
+	outputted *sync.Cond
+	// Sequence number of the next request gotten.
+	next uint64
+	// Sequence number of the next request to output.
+	flushed uint64
+	// Requests that are done being worked, but are waiting on earlier requests before being outputted.
+	pending map[uint64]sequencedRequest
+}
+
+type sequencedRequest struct {
+	request    Request
+	shouldSend bool
+}
+
+func newSequencer(window int) *sequencer {
+	if window < 1 {
+		window = 1
+	}
+	s := &sequencer{
+		window:  uint64(window),
+		pending: map[uint64]sequencedRequest{},
+	}
+	s.outputted = sync.NewCond(&s.mutex)
+	return s
+}
+
+// get gets the next request from the input along with its sequence number.
+// It waits for room in the window before getting the request.
+func (s *sequencer) get(in Input) (Request, uint64, bool) {
+	s.getMutex.Lock()
+	defer s.getMutex.Unlock()
+
+	s.mutex.Lock()
+	for s.next-s.flushed >= s.window {
+		s.outputted.Wait()
+	}
+	s.mutex.Unlock()
+
+	request, ok := in.Get()
+	if !ok {
+		return request, 0, false
+	}
+	s.mutex.Lock()
+	sequence := s.next
+	s.next++
+	s.mutex.Unlock()
+	return request, sequence, true
+}
+
+// put puts the request with the provided sequence number to the output once all requests before it have been outputted.
+func (s *sequencer) put(sequence uint64, r Request, out Output) {
+	s.done(sequence, sequencedRequest{request: r, shouldSend: true}, out)
+}
+
+// skip marks that the request with the provided sequence number will not be outputted,
+// so requests after it should not wait on it.
+func (s *sequencer) skip(sequence uint64, out Output) {
+	s.done(sequence, sequencedRequest{}, out)
+}
+
+func (s *sequencer) done(sequence uint64, r sequencedRequest, out Output) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.pending[sequence] = r
+	flushed := s.flushed
+	for {
+		next, found := s.pending[s.flushed]
+		if !found {
+			break
+		}
+		delete(s.pending, s.flushed)
+		if next.shouldSend {
+			out.Put(next.request)
+		}
+		s.flushed++
+	}
+	if s.flushed != flushed {
+		s.outputted.Broadcast()
+	}
+}
@@ -66,17 +66,33 @@ func (o MetricsOutput) Put(r Request) {
 		before := now()
 		o.Output.Put(r)
 		after := now()
-		if _, ok := o.Output.(FinalOutput); ok {
+		if isFinalOutput(o.Output) {
 			o.metricsHandler.HandleMetrics(
-				Metric{MetricsKeyOut, after.Sub(before)},
-				Metric{MetricsKeyTract, after.Sub(GetRequestStartTime(r))},
+				Metric{Key: MetricsKeyOut, Value: after.Sub(before)},
+				Metric{Key: MetricsKeyTract, Value: after.Sub(GetRequestStartTime(r))},
 			)
 		} else {
 			o.metricsHandler.HandleMetrics(
-				Metric{MetricsKeyOut, after.Sub(before)},
+				Metric{Key: MetricsKeyOut, Value: after.Sub(before)},
 			)
 		}
 	} else {
 		o.Output.Put(r)
 	}
 }
+
+// isFinalOutput checks if @out is a FinalOutput, seeing through the wrappers tracts put around their output.
+func isFinalOutput(out Output) bool {
+	for {
+		switch output := out.(type) {
+		case FinalOutput:
+			return true
+		case autoscaleOutput:
+			out = output.Output
+		case batchOutput:
+			out = output.Output
+		default:
+			return false
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package tract
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// OverflowPolicy decides what happens to a request put to a tract whose buffered input is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock waits for room in the buffer, stalling the tract putting the request.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropOldest drops the request that has waited in the buffer the longest to make room.
+	// Links without a buffer have no requests waiting in them, so the request being put is dropped instead.
+	OverflowDropOldest
+	// OverflowDropNewest drops the request being put.
+	OverflowDropNewest
+)
+
+var (
+	_ Output = &overflowOutput{}
+)
+
+// overflowPolicer is implemented by tracts that specify what happens when the link to their input is full.
+type overflowPolicer interface {
+	overflowPolicy() (OverflowPolicy, MetricsHandler)
+}
+
+// overflowPolicy gets the policy for when the link to the tract's input is full,
+// and the metrics handler dropped requests are reported to.
+func overflowPolicy(tract Tract) (OverflowPolicy, MetricsHandler) {
+	if o, ok := tract.(overflowPolicer); ok {
+		return o.overflowPolicy()
+	}
+	return OverflowBlock, nil
+}
+
+// linkOutput makes the output side of a link to @to.
+func linkOutput(to Tract, link chan Request) Output {
+	policy, metricsHandler := overflowPolicy(to)
+	if policy == OverflowBlock {
+		return OutputChannel(link)
+	}
+	if policy == OverflowDropOldest && cap(link) == 0 {
+		policy = OverflowDropNewest
+	}
+	return &overflowOutput{
+		link:           link,
+		policy:         policy,
+		metricsHandler: metricsHandler,
+	}
+}
+
+// overflowOutput is the output side of a link that drops requests instead of waiting when the link is full.
+type overflowOutput struct {
+	link           chan Request
+	policy         OverflowPolicy
+	metricsHandler MetricsHandler
+	// Amount of requests dropped since they were last reported
+	dropped int64
+	// Only one of the tracts putting to the link drops from it at a time,
+	// so none of them drops a request another one just put instead of the oldest.
+	dropMutex sync.Mutex
+}
+
+// Put puts the request onto the link, dropping a request if the link is full.
+func (o *overflowOutput) Put(r Request) {
+	if o.policy == OverflowDropOldest {
+		o.dropMutex.Lock()
+		defer o.dropMutex.Unlock()
+	}
+	for {
+		select {
+		case o.link <- r:
+			return
+		default:
+		}
+		if o.policy == OverflowDropNewest {
+			o.drop(r)
+			return
+		}
+		select {
+		case oldest := <-o.link:
+			o.drop(oldest)
+		default:
+		}
+	}
+}
+
+// drop cleans up a dropped request as failed, and reports how many requests have been dropped.
+func (o *overflowOutput) drop(r Request) {
+	cleanupRequest(r, false)
+	atomic.AddInt64(&o.dropped, 1)
+	if o.metricsHandler != nil && o.metricsHandler.ShouldHandle() {
+		o.metricsHandler.HandleMetrics(
+			Metric{Key: MetricsKeyDropped, Count: atomic.SwapInt64(&o.dropped, 0)},
+		)
+	}
+}
+
+// Close closes the link.
+func (o *overflowOutput) Close() {
+	close(o.link)
+}
@@ -0,0 +1,144 @@
+package tract
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultPrometheusBuckets are the upper bounds, in seconds, of the latency histogram buckets
+// used by a PrometheusMetricsHandler made without buckets of its own.
+var DefaultPrometheusBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+var (
+	_ MetricsHandler = &PrometheusMetricsHandler{}
+	_ http.Handler   = &PrometheusMetricsHandler{}
+)
+
+// prometheusStages are the metrics a PrometheusMetricsHandler aggregates, and the stage label they are exposed with.
+var prometheusStages = map[MetricsKey]string{
+	MetricsKeyIn:     "in",
+	MetricsKeyDuring: "during",
+	MetricsKeyOut:    "out",
+	MetricsKeyTract:  "tract",
+}
+
+// NewPrometheusMetricsHandler makes a PrometheusMetricsHandler whose histograms have buckets with the
+// upper bounds in @buckets, in seconds. If no buckets are given, DefaultPrometheusBuckets are used.
+func NewPrometheusMetricsHandler(buckets ...float64) *PrometheusMetricsHandler {
+	if len(buckets) == 0 {
+		buckets = DefaultPrometheusBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &PrometheusMetricsHandler{
+		buckets:    buckets,
+		histograms: map[prometheusLabels]*prometheusHistogram{},
+	}
+}
+
+// PrometheusMetricsHandler is a MetricsHandler that aggregates MetricsKeyIn, MetricsKeyDuring, MetricsKeyOut,
+// and MetricsKeyTract metrics into latency histograms labeled by the name and path of the tract that produced them.
+// It is also an http.Handler that serves the histograms in the Prometheus text exposition format, as the
+// tract_request_latency_seconds metric with "tract", "path" and "stage" labels. Metrics without a path have no
+// "path" label. It can be shared by many tracts, including tracts with the same name in different groups.
+type PrometheusMetricsHandler struct {
+	buckets    []float64
+	mutex      sync.Mutex
+	histograms map[prometheusLabels]*prometheusHistogram
+}
+
+type prometheusLabels struct {
+	tract string
+	path  string
+	stage string
+}
+
+type prometheusHistogram struct {
+	// Amount of observations in each bucket, not including the ones in lower buckets.
+	// The last bucket is for observations above all of the bucket upper bounds.
+	buckets []uint64
+	sum     float64
+	count   uint64
+}
+
+// HandleMetrics adds the latency metrics to their histograms.
+func (h *PrometheusMetricsHandler) HandleMetrics(metrics ...Metric) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for _, metric := range metrics {
+		stage, ok := prometheusStages[metric.Key]
+		if !ok {
+			continue
+		}
+		labels := prometheusLabels{tract: metric.Tract, path: metric.Path, stage: stage}
+		histogram, ok := h.histograms[labels]
+		if !ok {
+			histogram = &prometheusHistogram{buckets: make([]uint64, len(h.buckets)+1)}
+			h.histograms[labels] = histogram
+		}
+		seconds := metric.Value.Seconds()
+		histogram.buckets[sort.SearchFloat64s(h.buckets, seconds)]++
+		histogram.sum += seconds
+		histogram.count++
+	}
+}
+
+// ShouldHandle always returns true.
+func (h *PrometheusMetricsHandler) ShouldHandle() bool {
+	return true
+}
+
+// ServeHTTP writes the histograms in the Prometheus text exposition format.
+func (h *PrometheusMetricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	fmt.Fprint(w, h.exposition())
+}
+
+func (h *PrometheusMetricsHandler) exposition() string {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	labels := make([]prometheusLabels, 0, len(h.histograms))
+	for l := range h.histograms {
+		labels = append(labels, l)
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		if labels[i].tract != labels[j].tract {
+			return labels[i].tract < labels[j].tract
+		}
+		if labels[i].path != labels[j].path {
+			return labels[i].path < labels[j].path
+		}
+		return labels[i].stage < labels[j].stage
+	})
+
+	const name = "tract_request_latency_seconds"
+	var b strings.Builder
+	fmt.Fprintf(&b, "# HELP %s Time requests spent in each stage of a tract.\n", name)
+	fmt.Fprintf(&b, "# TYPE %s histogram\n", name)
+	for _, l := range labels {
+		histogram := h.histograms[l]
+		labelPairs := fmt.Sprintf(`tract="%s",`, escapePrometheusLabel(l.tract))
+		if l.path != "" {
+			labelPairs += fmt.Sprintf(`path="%s",`, escapePrometheusLabel(l.path))
+		}
+		labelPairs += fmt.Sprintf(`stage="%s"`, l.stage)
+		var cumulative uint64
+		for i, upperBound := range h.buckets {
+			cumulative += histogram.buckets[i]
+			fmt.Fprintf(&b, "%s_bucket{%s,le=\"%s\"} %d\n", name, labelPairs, strconv.FormatFloat(upperBound, 'g', -1, 64), cumulative)
+		}
+		fmt.Fprintf(&b, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labelPairs, histogram.count)
+		fmt.Fprintf(&b, "%s_sum{%s} %s\n", name, labelPairs, strconv.FormatFloat(histogram.sum, 'g', -1, 64))
+		fmt.Fprintf(&b, "%s_count{%s} %d\n", name, labelPairs, histogram.count)
+	}
+	return b.String()
+}
+
+// escapePrometheusLabel escapes a label value for the Prometheus text exposition format.
+func escapePrometheusLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
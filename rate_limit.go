@@ -0,0 +1,66 @@
+package tract
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// rateLimiter is a token bucket shared by all workers in a worker tract.
+// Tokens are refilled at a constant rate up to a burst amount. Each request takes a token,
+// and when there are none left requests reserve future tokens and wait for them.
+type rateLimiter struct {
+	// Tokens refilled per second
+	rate float64
+	// Maximum amount of tokens held
+	burst float64
+
+	mutex sync.Mutex
+	// Available tokens, negative when future tokens have been reserved
+	tokens float64
+	// Last time tokens were refilled
+	last time.Time
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// reserve takes a token, and returns how long to wait until that token is available.
+func (l *rateLimiter) reserve() time.Duration {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	current := time.Now()
+	l.tokens += current.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = current
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// wait waits for a token while gathering metrics. It returns false if the context is done before then.
+func (l *rateLimiter) wait(ctx context.Context, mh MetricsHandler) bool {
+	if mh != nil && mh.ShouldHandle() {
+		before := now()
+		ok := sleepContext(ctx, l.reserve())
+		after := now()
+		mh.HandleMetrics(
+			Metric{Key: MetricsKeyRateLimit, Value: after.Sub(before)},
+		)
+		return ok
+	}
+	return sleepContext(ctx, l.reserve())
+}
@@ -0,0 +1,90 @@
+package tract
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+)
+
+// PanicError is the error attached to a request a worker panicked while working.
+type PanicError struct {
+	// Value is the value the worker panicked with.
+	Value interface{}
+	// Stack is the stack trace of the goroutine when the worker panicked.
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("worker panicked: %v", e.Value)
+}
+
+var (
+	_ Worker = &recoverWorker{}
+)
+
+// recoverWorker is a wrapper around a Worker that fails requests the worker panics on instead of crashing.
+type recoverWorker struct {
+	worker Worker
+	// Makes a worker to replace one that panicked (optional)
+	replace func() (Worker, error)
+	// Called with each request the worker panicked on (optional)
+	handler        func(Request, *PanicError)
+	metricsHandler MetricsHandler
+}
+
+func (w *recoverWorker) Work(r Request) (request Request, ok bool) {
+	before := now()
+	defer func() {
+		value := recover()
+		if value == nil {
+			return
+		}
+		err := &PanicError{
+			Value: value,
+			Stack: debug.Stack(),
+		}
+		if w.metricsHandler != nil && w.metricsHandler.ShouldHandle() {
+			w.metricsHandler.HandleMetrics(
+				Metric{Key: MetricsKeyPanic, Value: now().Sub(before)},
+			)
+		}
+		request, ok = setRequestError(r, err), false
+		if w.handler != nil {
+			w.handler(request, err)
+		}
+		if w.replace != nil {
+			// The worker may have been left in a bad state. If a new one can't be made, keep using it.
+			if worker, replaceErr := w.replace(); replaceErr == nil {
+				w.worker = worker
+			}
+		}
+	}()
+	return w.worker.Work(r)
+}
+
+func (w *recoverWorker) Close() {
+	w.worker.Close()
+}
+
+// recoveredPanic checks if a request failed because the tract recovered from its worker panicking on it.
+func (p *workerTract) recoveredPanic(r Request) bool {
+	if !p.panicRecovery {
+		return false
+	}
+	var panicErr *PanicError
+	return errors.As(GetRequestError(r), &panicErr)
+}
+
+// replaceWorker makes a new worker to replace the worker at index @i of the tract's workers, and closes the old one.
+func (p *workerTract) replaceWorker(i int) (Worker, error) {
+	worker, err := p.factory.MakeWorker()
+	if err != nil {
+		return nil, err
+	}
+	p.workersMutex.Lock()
+	oldWorker := p.workers[i]
+	p.workers[i] = worker
+	p.workersMutex.Unlock()
+	oldWorker.Close()
+	return worker, nil
+}
@@ -24,6 +24,51 @@ func setRequestStartTime(r Request, t time.Time) Request {
 	return context.WithValue(r, requestTimeStartKey{}, t)
 }
 
+// requestErrorKey is the key to retreive the error a worker failed a request with.
+// Request value type is error
+type requestErrorKey struct{}
+
+// GetRequestError gets the error the request failed with.
+// If the request has not failed, or failed without an error, nil is returned.
+func GetRequestError(r Request) error {
+	err, _ := r.Value(requestErrorKey{}).(error)
+	return err
+}
+
+func setRequestError(r Request, err error) Request {
+	return context.WithValue(r, requestErrorKey{}, err)
+}
+
+// requestRejectedByKey is the key to retreive the name of the tract that rejected a request.
+// Request value type is string
+type requestRejectedByKey struct{}
+
+// GetRequestRejectedBy gets the name of the tract whose worker rejected the request.
+// If the request has not been rejected to a reject output, an empty string is returned.
+func GetRequestRejectedBy(r Request) string {
+	name, _ := r.Value(requestRejectedByKey{}).(string)
+	return name
+}
+
+func setRequestRejectedBy(r Request, name string) Request {
+	return context.WithValue(r, requestRejectedByKey{}, name)
+}
+
+// requestAttemptsKey is the key to retreive the number of times a retrying worker has attempted a request.
+// Request value type is int
+type requestAttemptsKey struct{}
+
+// GetRequestAttempts gets the number of times a retrying worker has attempted to work the request.
+// If the request has not been worked by a retrying worker, zero is returned.
+func GetRequestAttempts(r Request) int {
+	attempts, _ := r.Value(requestAttemptsKey{}).(int)
+	return attempts
+}
+
+func setRequestAttempts(r Request, attempts int) Request {
+	return context.WithValue(r, requestAttemptsKey{}, attempts)
+}
+
 // Request value type is cleanups
 type cleanupKey struct{}
 type cleanups []func(r Request, success bool)
@@ -57,10 +102,29 @@ func cleanupRequest(r Request, success bool) {
 	for _, f := range cleanupFuncs {
 		f(r, success)
 	}
+	finalizers, _ := r.Value(finalizerKey{}).(cleanups)
+	for i := len(finalizers) - 1; i >= 0; i-- {
+		finalizers[i](r, success)
+	}
+}
+
+// Request value type is cleanups
+type finalizerKey struct{}
+
+// addRequestFinalizer adds a function to the request that will be run when the request dies, after all of its cleanups.
+// Finalizers are used within tracts to know a request is done once its cleanups are, so they are run in the reverse
+// order they were added, and are not removed by RemoveAllRequestCleanups.
+func addRequestFinalizer(r Request, f func(Request, bool)) Request {
+	finalizers, _ := r.Value(finalizerKey{}).(cleanups)
+	// Copy so requests derived from the same request don't share finalizers.
+	finalizers = append(finalizers[:len(finalizers):len(finalizers)], f)
+	return context.WithValue(r, finalizerKey{}, finalizers)
 }
 
-// swapCleanups sets the request cleanup ot be the provided cleanup, and retunrs the old cleanup.
-func swapCleanups(r Request, cleanupFuncs cleanups) (Request, cleanups) {
+// swapCleanups sets the request cleanups and finalizers to be the provided ones, and retunrs the old ones.
+func swapCleanups(r Request, cleanupFuncs, finalizers cleanups) (Request, cleanups, cleanups) {
 	oldCleaupFuncs, _ := r.Value(cleanupKey{}).(cleanups)
-	return context.WithValue(r, cleanupKey{}, cleanupFuncs), oldCleaupFuncs
+	oldFinalizers, _ := r.Value(finalizerKey{}).(cleanups)
+	r = context.WithValue(r, cleanupKey{}, cleanupFuncs)
+	return context.WithValue(r, finalizerKey{}, finalizers), oldCleaupFuncs, oldFinalizers
 }
@@ -0,0 +1,171 @@
+package tract
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy decides if and when a Worker should work a failed request again.
+type RetryPolicy interface {
+	// Backoff is called after an attempt at working a request failed. It is given the number of attempts
+	// made so far, and the time elapsed since the first attempt started. It returns how long to wait
+	// before the next attempt, and false if no more attempts should be made.
+	Backoff(attempts int, elapsed time.Duration) (time.Duration, bool)
+}
+
+var (
+	_ RetryPolicy = fixedRetryPolicy{}
+	_ RetryPolicy = exponentialRetryPolicy{}
+	_ RetryPolicy = maxAttemptsRetryPolicy{}
+	_ RetryPolicy = maxElapsedTimeRetryPolicy{}
+
+	_ Worker = retryWorker{}
+)
+
+// NewFixedRetryPolicy makes a RetryPolicy that always waits @interval between attempts.
+// It never stops retrying on its own; limit it with NewMaxAttemptsRetryPolicy or NewMaxElapsedTimeRetryPolicy.
+func NewFixedRetryPolicy(interval time.Duration) RetryPolicy {
+	return fixedRetryPolicy{interval: interval}
+}
+
+type fixedRetryPolicy struct {
+	interval time.Duration
+}
+
+func (p fixedRetryPolicy) Backoff(int, time.Duration) (time.Duration, bool) {
+	return p.interval, true
+}
+
+// NewExponentialRetryPolicy makes a RetryPolicy that waits @initial after the first attempt, and doubles
+// the wait after each following attempt up to @max. Each wait is randomly adjusted by up to @jitter
+// (a fraction between 0 and 1) of itself in either direction, so that many failing requests don't retry in lockstep.
+// It never stops retrying on its own; limit it with NewMaxAttemptsRetryPolicy or NewMaxElapsedTimeRetryPolicy.
+func NewExponentialRetryPolicy(initial, max time.Duration, jitter float64) RetryPolicy {
+	return exponentialRetryPolicy{
+		initial: initial,
+		max:     max,
+		jitter:  math.Max(0, math.Min(1, jitter)),
+	}
+}
+
+type exponentialRetryPolicy struct {
+	initial time.Duration
+	max     time.Duration
+	jitter  float64
+}
+
+func (p exponentialRetryPolicy) Backoff(attempts int, _ time.Duration) (time.Duration, bool) {
+	backoff := float64(p.initial) * math.Pow(2, float64(attempts-1))
+	if backoff > float64(p.max) {
+		backoff = float64(p.max)
+	}
+	if p.jitter > 0 {
+		backoff += backoff * p.jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(backoff), true
+}
+
+// NewMaxAttemptsRetryPolicy makes a RetryPolicy that follows @policy, but stops retrying once a request has
+// been attempted @maxAttempts times.
+func NewMaxAttemptsRetryPolicy(maxAttempts int, policy RetryPolicy) RetryPolicy {
+	return maxAttemptsRetryPolicy{
+		RetryPolicy: policy,
+		maxAttempts: maxAttempts,
+	}
+}
+
+type maxAttemptsRetryPolicy struct {
+	RetryPolicy
+	maxAttempts int
+}
+
+func (p maxAttemptsRetryPolicy) Backoff(attempts int, elapsed time.Duration) (time.Duration, bool) {
+	if attempts >= p.maxAttempts {
+		return 0, false
+	}
+	return p.RetryPolicy.Backoff(attempts, elapsed)
+}
+
+// NewMaxElapsedTimeRetryPolicy makes a RetryPolicy that follows @policy, but stops retrying once the next
+// attempt would start more than @maxElapsedTime after the first attempt started.
+func NewMaxElapsedTimeRetryPolicy(maxElapsedTime time.Duration, policy RetryPolicy) RetryPolicy {
+	return maxElapsedTimeRetryPolicy{
+		RetryPolicy:    policy,
+		maxElapsedTime: maxElapsedTime,
+	}
+}
+
+type maxElapsedTimeRetryPolicy struct {
+	RetryPolicy
+	maxElapsedTime time.Duration
+}
+
+func (p maxElapsedTimeRetryPolicy) Backoff(attempts int, elapsed time.Duration) (time.Duration, bool) {
+	backoff, ok := p.RetryPolicy.Backoff(attempts, elapsed)
+	if !ok || elapsed+backoff > p.maxElapsedTime {
+		return 0, false
+	}
+	return backoff, true
+}
+
+// NewRetryWorker makes a Worker that works requests using @worker, working them again according to @policy
+// whenever they fail with an error. Requests that are not sent without an error are not retried.
+// The number of attempts made is stored on the request, and can be retrieved by using GetRequestAttempts().
+// To also gather metrics for each attempt, use the WithRetry WorkerTractOption instead.
+func NewRetryWorker(worker Worker, policy RetryPolicy) Worker {
+	return retryWorker{
+		Worker: worker,
+		policy: policy,
+	}
+}
+
+type retryWorker struct {
+	Worker
+	policy         RetryPolicy
+	metricsHandler MetricsHandler
+}
+
+func (w retryWorker) Work(r Request) (Request, bool) {
+	var (
+		request Request
+		ok      bool
+		start   = now()
+	)
+	for attempts := 1; ; attempts++ {
+		attemptRequest := setRequestAttempts(r, attempts)
+		if w.metricsHandler != nil && w.metricsHandler.ShouldHandle() {
+			before := now()
+			request, ok = w.Worker.Work(attemptRequest)
+			after := now()
+			w.metricsHandler.HandleMetrics(
+				Metric{Key: MetricsKeyAttempt, Value: after.Sub(before)},
+			)
+		} else {
+			request, ok = w.Worker.Work(attemptRequest)
+		}
+		if ok || GetRequestError(request) == nil {
+			return request, ok
+		}
+		backoff, retry := w.policy.Backoff(attempts, now().Sub(start))
+		if !retry || !sleepContext(r, backoff) {
+			return request, false
+		}
+	}
+}
+
+// sleepContext sleeps for the provided duration. It returns false if the context is done before then.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
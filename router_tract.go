@@ -0,0 +1,77 @@
+package tract
+
+import (
+	"context"
+	"sync"
+)
+
+// routerTract puts each request to one of its outputs, chosen by its route function.
+// Its outputs are the group's inner tracts in order, followed by the default tract.
+type routerTract struct {
+	input   Input
+	outputs []Output
+	route   func(Request) int
+}
+
+func (p *routerTract) Name() string {
+	return "router"
+}
+
+func (p *routerTract) Init() error {
+	return nil
+}
+
+func (p *routerTract) Start() func() {
+	return p.StartContext(context.Background())
+}
+
+func (p *routerTract) StartContext(ctx context.Context) func() {
+	input := contextInput{Input: p.input, ctx: ctx}
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			inputValue, ok := input.Get()
+			if !ok {
+				break
+			}
+			if ctx.Err() != nil {
+				cleanupRequest(inputValue, false)
+				continue
+			}
+			p.outputs[p.outputIndex(inputValue)].Put(inputValue)
+		}
+	}()
+
+	return func() {
+		wg.Wait()
+		for _, output := range p.outputs {
+			output.Close()
+		}
+	}
+}
+
+// outputIndex gets the index of the output a request is routed to.
+// Requests routed outside of the inner tracts go to the default tract, which is the last output.
+func (p *routerTract) outputIndex(r Request) int {
+	defaultIndex := len(p.outputs) - 1
+	index := p.route(r)
+	if index < 0 || index >= defaultIndex {
+		return defaultIndex
+	}
+	return index
+}
+
+func (p *routerTract) SetInput(in Input) {
+	p.input = in
+}
+
+// routerTract is never available directly externally. It's outputs are only set internally,
+// so this implementation of ever growing number of outputs is not liable to growing out of control.
+func (p *routerTract) SetOutput(out Output) {
+	p.outputs = append(p.outputs, out)
+}
+
+// routerTract never rejects requests.
+func (p *routerTract) SetRejectOutput(out Output) {}
@@ -0,0 +1,31 @@
+package tract
+
+import (
+	"context"
+	"time"
+)
+
+// requestTimeoutKey marks a request as having a deadline applied by a tract.
+// Request value type is time.Time
+type requestTimeoutKey struct{}
+
+// withRequestTimeout derives a request that will time out after @timeout.
+// If the request already has an earlier deadline, that deadline still applies.
+// The timer is stopped when the request is cleaned up.
+func withRequestTimeout(r Request, timeout time.Duration) Request {
+	ctx, cancel := context.WithTimeout(r, timeout)
+	deadline, _ := ctx.Deadline()
+	r = context.WithValue(ctx, requestTimeoutKey{}, deadline)
+	return addRequestFinalizer(r, func(Request, bool) {
+		cancel()
+	})
+}
+
+// requestTimedOut checks if a request's deadline has passed after a tract applied one.
+// Deadlines of requests passed into a tract by the user are left for the workers to handle.
+func requestTimedOut(r Request) bool {
+	if r.Value(requestTimeoutKey{}) == nil {
+		return false
+	}
+	return r.Err() == context.DeadlineExceeded
+}
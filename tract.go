@@ -1,13 +1,51 @@
 package tract
 
+import (
+	"context"
+	"errors"
+)
+
 var (
 	_ Tract = &workerTract{}
 	_ Tract = &serialGroupTract{}
 	_ Tract = &paralellGroupTract{}
 	_ Tract = &fanOutGroupTract{}
 	_ Tract = &fanOutTract{}
+	_ Tract = &routerGroupTract{}
+	_ Tract = &routerTract{}
+	_ Tract = &fanOutJoinGroupTract{}
+	_ Tract = &fanOutJoinTract{}
 )
 
+// InitError is the error returned by Init when a tract failed to initialize.
+// It identifies the tract that failed by its path of tract names, from the tract Init was called on down to
+// the one that failed, such as "pipeline/parse/worker[3]" for the fourth worker of the "parse" worker tract
+// in the "pipeline" group. Any tracts in a group that were already initialized are torn down before it is returned.
+type InitError struct {
+	// Path of the tract that failed.
+	Path string
+	// Err is why the tract failed.
+	Err error
+}
+
+func (e *InitError) Error() string {
+	return e.Path + ": " + e.Err.Error()
+}
+
+// Unwrap gets why the tract failed.
+func (e *InitError) Unwrap() error {
+	return e.Err
+}
+
+// newGroupInitError makes the error a group named @name returns when its inner @tract failed to initialize with @err.
+func newGroupInitError(name string, tract Tract, err error) *InitError {
+	var initErr *InitError
+	if errors.As(err, &initErr) {
+		return &InitError{Path: name + "/" + initErr.Path, Err: initErr.Err}
+	}
+	return &InitError{Path: name + "/" + tract.Name(), Err: err}
+}
+
 // Tract is a highly concurrent, scalable design pattern.
 // Tracts receive and pass Requests from/to other Tracts. Tracts can be combined to form a single group Tract.
 // Each sub-Tract in a group has a job it does with the base sub-Tract being a Worker Tract.
@@ -18,9 +56,12 @@ var (
 // A Tract lifecycle is as follows:
 //  1. myTract is constructed by one of the Tract contructors in this package.
 //  2. myTract is initialized by calling myTract.Init().
-//     * if Init() returns an error, it is not safe to proceed.
+//     * if Init() returns an error, it is not safe to proceed. The error is an *InitError identifying
+//       the tract that failed, and everything already initialized has been torn down.
 //  3. myTract is started by calling myTract.Start().
 //  4. myTract is closed by calling the callback returned from Start().
+//     * if started with tract.StartContext(), cancelling the context will also shut the Tract down.
+//     * if started with StartDrainable(), draining the Tract shuts it down within a deadline.
 //  5. myTract can be used again by looping back to step 2 (by default).
 //     * Init() -> Start()() -> Init() ...
 //
@@ -28,6 +69,11 @@ var (
 //  1. The base case first Tract is a Worker Tract. It's Worker can be viewed as the Request generator.
 //     When that Worker returns a "should not send" from Work(), there are no more Request, and the Tract will shutdown.
 //  2. The Tract's input has been manually set by the user. The user contols Tract shutdown using that input.
+//  3. The Tract was started with tract.StartContext(), and that context was cancelled. No more requests will be
+//     taken from the Tract's input, and requests already in flight are drained out of the Tract with their
+//     cleanups run as unsuccessful.
+//  4. The Tract was started with StartDrainable(), and is being drained. No more requests will be taken
+//     from the Tract's input, and requests already in flight are worked until the drain deadline passes.
 //
 // Usage:
 //  myTract := tract.NewXYZTract(...)
@@ -62,3 +108,42 @@ type Tract interface {
 	// in which case the groups SetOutput should be used instead.
 	SetOutput(Output)
 }
+
+// contextStarter is implemented by tracts that can be started with a context.
+// Every tract made by this package is one.
+type contextStarter interface {
+	StartContext(ctx context.Context) func()
+}
+
+// StartContext starts @tract the same as its Start method, but the Tract will also shut down when @ctx is done.
+// Requests generated by a head Worker Tract will be derived from @ctx.
+// A Tract waiting on a user set input stops waiting once @ctx is done if the input is an InputChannel or an
+// InterruptibleInput. Other inputs are never given up on mid wait, so the Tract only shuts down once they return.
+// User implemented Tracts without a StartContext(context.Context) func() method are started with Start,
+// and only shut down the usual way.
+func StartContext(ctx context.Context, tract Tract) func() {
+	if starter, ok := tract.(contextStarter); ok {
+		return starter.StartContext(ctx)
+	}
+	return tract.Start()
+}
+
+// rejectOutputSetter is implemented by tracts that can output the requests rejected within them.
+// Every tract made by this package is one.
+type rejectOutputSetter interface {
+	SetRejectOutput(Output)
+}
+
+// SetRejectOutput sets the output for requests rejected within @tract.
+// Setting it on a group tract sets it for every tract within the group, and the group
+// will close it once all of them are finished. Worker Tracts using the WithRejectOutput
+// option will use their own reject output instead.
+// User implemented Tracts without a SetRejectOutput(Output) method keep cleaning up the requests they reject,
+// in which case false is returned.
+func SetRejectOutput(tract Tract, out Output) bool {
+	setter, ok := tract.(rejectOutputSetter)
+	if ok {
+		setter.SetRejectOutput(out)
+	}
+	return ok
+}
@@ -2,7 +2,12 @@ package tract
 
 import (
 	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -111,35 +116,397 @@ func TestWithMetricsHandler(t *testing.T) {
 
 	waitOnTract := workerTract.Start()
 
+	// Skip the tract's request counts, which are not about latency.
+	nextLatencyMetric := func() Metric {
+		for {
+			metric := <-metricsChannel
+			if metric.Key < MetricsKeyReceived {
+				return metric
+			}
+		}
+	}
+
 	inputChannel <- context.Background()
-	metric := <-metricsChannel
-	expectedMetric := Metric{Key: MetricsKeyIn, Value: 1 * time.Second}
+	metric := nextLatencyMetric()
+	expectedMetric := Metric{Key: MetricsKeyIn, Value: 1 * time.Second, Tract: "waiter", Path: "waiter", Worker: 1}
 	if metric != expectedMetric {
 		t.Errorf("unexpected metric for tract input expected: %+#v, recieved: %+#v", expectedMetric, metric)
 	}
 
 	*workerNewTime = time.Date(2019, time.July, 22, 0, 1, 0, 0, time.UTC) // 59 second duration
 	workerWaiterChannel <- struct{}{}
-	metric = <-metricsChannel
-	expectedMetric = Metric{Key: MetricsKeyDuring, Value: 59 * time.Second}
+	metric = nextLatencyMetric()
+	expectedMetric = Metric{Key: MetricsKeyDuring, Value: 59 * time.Second, Tract: "waiter", Path: "waiter", Worker: 1}
 	if metric != expectedMetric {
 		t.Errorf("unexpected metric for tract input expected: %+#v, recieved: %+#v", expectedMetric, metric)
 	}
 
 	output.setPrePutFunc(func() { now = func() time.Time { return time.Date(2019, time.July, 22, 1, 0, 0, 0, time.UTC) } }) // 59 minute duration
 	<-outputChannel
-	metric = <-metricsChannel
-	expectedMetric = Metric{Key: MetricsKeyOut, Value: 59 * time.Minute}
+	metric = nextLatencyMetric()
+	expectedMetric = Metric{Key: MetricsKeyOut, Value: 59 * time.Minute, Tract: "waiter", Path: "waiter", Worker: 1}
 	if metric != expectedMetric {
 		t.Errorf("unexpected metric for tract input expected: %+#v, recieved: %+#v", expectedMetric, metric)
 	}
 
 	input.setPreGetFunc(func() { now = func() time.Time { return time.Date(2019, time.July, 23, 0, 0, 0, 0, time.UTC) } }) // 23 hour duration
 	close(inputChannel)
-	metric = <-metricsChannel
-	expectedMetric = Metric{Key: MetricsKeyIn, Value: 23 * time.Hour}
+	metric = nextLatencyMetric()
+	expectedMetric = Metric{Key: MetricsKeyIn, Value: 23 * time.Hour, Tract: "waiter", Path: "waiter", Worker: 1}
 	if metric != expectedMetric {
 		t.Errorf("unexpected metric for tract input expected: %+#v, recieved: %+#v", expectedMetric, metric)
 	}
+	// The tract reports its request counts one last time when it closes.
+	go func() {
+		for range metricsChannel {
+		}
+	}()
 	waitOnTract()
+	close(metricsChannel)
+}
+
+func TestTractLatencyMetrics(t *testing.T) {
+	worker := testWorker{
+		work: func(r Request) (Request, bool) {
+			return r, true
+		},
+	}
+	tests := []struct {
+		name     string
+		newTract func(MetricsHandler) Tract
+	}{
+		{
+			name: "worker",
+			newTract: func(h MetricsHandler) Tract {
+				return NewWorkerTract("last", 1, NewFactoryFromWorker(worker), WithMetricsHandler(h))
+			},
+		},
+		{
+			name: "autoscaled",
+			newTract: func(h MetricsHandler) Tract {
+				return NewWorkerTract("last", 1, NewFactoryFromWorker(worker), WithMetricsHandler(h), WithAutoscaling(1, 2, time.Second))
+			},
+		},
+		{
+			name: "batch",
+			newTract: func(h MetricsHandler) Tract {
+				return NewBatchTract("last", 1, 1, 0, NewBatchFactoryFromWorker(testBatchWorker{}), WithMetricsHandler(h))
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			metricsChannel := make(chan Metric, 64)
+			myTract := test.newTract(testMetricHandler{metricsChannel: metricsChannel})
+			inputChannel := make(chan Request, 3)
+			for i := 0; i < cap(inputChannel); i++ {
+				inputChannel <- context.Background()
+			}
+			close(inputChannel)
+			myTract.SetInput(InputChannel(inputChannel))
+
+			err := myTract.Init()
+			if err != nil {
+				t.Fatalf("unexpected error during tract initialization %v", err)
+			}
+			myTract.Start()()
+			close(metricsChannel)
+
+			// The tract is at the end of the pipeline, so it reports how long each request took through it.
+			var numberOfTractMetrics int
+			for metric := range metricsChannel {
+				if metric.Key == MetricsKeyTract {
+					numberOfTractMetrics++
+				}
+			}
+			if numberOfTractMetrics != cap(inputChannel) {
+				t.Errorf("number of tract metrics: expected %d, received %d", cap(inputChannel), numberOfTractMetrics)
+			}
+		})
+	}
+}
+
+type testBatchWorker struct{}
+
+func (w testBatchWorker) Work(batch []Request) ([]Request, []bool) {
+	shouldSend := make([]bool, len(batch))
+	for i := range shouldSend {
+		shouldSend[i] = true
+	}
+	return batch, shouldSend
+}
+
+func (w testBatchWorker) Close() {}
+
+func TestInputBufferMetrics(t *testing.T) {
+	metricsChannel := make(chan Metric, 64)
+	workerTract := NewWorkerTract("buffered", 1,
+		NewFactoryFromWorker(testWorker{
+			work: func(r Request) (Request, bool) { return r, true },
+		}),
+		WithMetricsHandler(testMetricHandler{
+			metricsChannel: metricsChannel,
+		}),
+	)
+	inputChannel := make(chan Request, 3)
+	for i := 0; i < cap(inputChannel); i++ {
+		inputChannel <- context.Background()
+	}
+	close(inputChannel)
+	workerTract.SetInput(InputChannel(inputChannel))
+
+	err := workerTract.Init()
+	if err != nil {
+		t.Fatalf("unexpected error during tract initialization %v", err)
+	}
+	workerTract.Start()()
+	close(metricsChannel)
+
+	bufferLengths := []int64{}
+	for metric := range metricsChannel {
+		if metric.Key == MetricsKeyInBuffer {
+			bufferLengths = append(bufferLengths, metric.Count)
+		}
+	}
+	expectedBufferLengths := []int64{3, 2, 1, 0}
+	if !reflect.DeepEqual(bufferLengths, expectedBufferLengths) {
+		t.Errorf("input buffer lengths: expected %v, received %v", expectedBufferLengths, bufferLengths)
+	}
+}
+
+func TestPrometheusMetricsHandler(t *testing.T) {
+	handler := NewPrometheusMetricsHandler(0.1, 1)
+	handler.HandleMetrics(
+		Metric{Key: MetricsKeyDuring, Value: 50 * time.Millisecond, Tract: "parse"},
+		Metric{Key: MetricsKeyDuring, Value: 500 * time.Millisecond, Tract: "parse"},
+		Metric{Key: MetricsKeyDuring, Value: 2 * time.Second, Tract: "parse"},
+		Metric{Key: MetricsKeyIn, Value: time.Second, Tract: `"quoted"`},
+		// Metrics that are not latencies of a stage are ignored.
+		Metric{Key: MetricsKeyInBuffer, Count: 3, Tract: "parse"},
+	)
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if contentType := recorder.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain; version=0.0.4") {
+		t.Errorf("content type: expected Prometheus text format, received %q", contentType)
+	}
+	expectedBody := `# HELP tract_request_latency_seconds Time requests spent in each stage of a tract.
+# TYPE tract_request_latency_seconds histogram
+tract_request_latency_seconds_bucket{tract="\"quoted\"",stage="in",le="0.1"} 0
+tract_request_latency_seconds_bucket{tract="\"quoted\"",stage="in",le="1"} 1
+tract_request_latency_seconds_bucket{tract="\"quoted\"",stage="in",le="+Inf"} 1
+tract_request_latency_seconds_sum{tract="\"quoted\"",stage="in"} 1
+tract_request_latency_seconds_count{tract="\"quoted\"",stage="in"} 1
+tract_request_latency_seconds_bucket{tract="parse",stage="during",le="0.1"} 1
+tract_request_latency_seconds_bucket{tract="parse",stage="during",le="1"} 2
+tract_request_latency_seconds_bucket{tract="parse",stage="during",le="+Inf"} 3
+tract_request_latency_seconds_sum{tract="parse",stage="during"} 2.55
+tract_request_latency_seconds_count{tract="parse",stage="during"} 3
+`
+	if body := recorder.Body.String(); body != expectedBody {
+		t.Errorf("exposition: expected:\n%s\nreceived:\n%s", expectedBody, body)
+	}
+}
+
+func TestPrometheusMetricsHandlerPath(t *testing.T) {
+	handler := NewPrometheusMetricsHandler(1)
+	// 3 requests
+	workSource := []struct{}{2: {}}
+	passWorker := NewFactoryFromWorker(testWorker{
+		work: func(r Request) (Request, bool) {
+			return r, true
+		},
+	})
+	// Both groups have a tract named "parse".
+	myTract := NewSerialGroupTract("pipeline",
+		NewWorkerTract("read", 1, NewFactoryFromWorker(testWorker{
+			work: func(r Request) (Request, bool) {
+				if len(workSource) == 0 {
+					return r, false
+				}
+				workSource = workSource[1:]
+				return r, true
+			},
+		})),
+		NewSerialGroupTract("a", NewWorkerTract("parse", 1, passWorker, WithMetricsHandler(handler))),
+		NewSerialGroupTract("b", NewWorkerTract("parse", 1, passWorker, WithMetricsHandler(handler))),
+	)
+
+	err := myTract.Init()
+	if err != nil {
+		t.Fatalf("unexpected error during tract initialization %v", err)
+	}
+	myTract.Start()()
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := recorder.Body.String()
+	for _, expectedLine := range []string{
+		`tract_request_latency_seconds_count{tract="parse",path="pipeline/a/parse",stage="during"} 3`,
+		`tract_request_latency_seconds_count{tract="parse",path="pipeline/b/parse",stage="during"} 3`,
+	} {
+		if !strings.Contains(body, expectedLine+"\n") {
+			t.Errorf("exposition: expected line:\n%s\nreceived:\n%s", expectedLine, body)
+		}
+	}
+}
+
+func TestDefaultMetricsThrottler(t *testing.T) {
+	// sampled counts how many of @calls calls to ShouldHandle, split across goroutines, are true.
+	sampled := func(throttler DefaultMetricsThrottler, calls int) int64 {
+		const goroutines = 8
+		var (
+			wg    sync.WaitGroup
+			count int64
+		)
+		for g := 0; g < goroutines; g++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < calls/goroutines; i++ {
+					// Each goroutine uses its own copy, as each worker does when composed in a handler.
+					if throttler.ShouldHandle() {
+						atomic.AddInt64(&count, 1)
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		return count
+	}
+
+	tests := []struct {
+		name      string
+		throttler DefaultMetricsThrottler
+		min, max  int64
+	}{
+		{name: "zero value", throttler: DefaultMetricsThrottler{}, min: 8000, max: 8000},
+		{name: "zero frequency", throttler: NewDefaultMetricsThrottler(0), min: 8000, max: 8000},
+		{name: "negative frequency", throttler: NewDefaultMetricsThrottler(-1), min: 0, max: 0},
+		{name: "long frequency", throttler: NewDefaultMetricsThrottler(time.Hour), min: 0, max: 0},
+		{name: "every request", throttler: NewEveryNMetricsThrottler(1), min: 8000, max: 8000},
+		{name: "every 10 requests", throttler: NewEveryNMetricsThrottler(10), min: 800, max: 800},
+		{name: "every 0 requests", throttler: NewEveryNMetricsThrottler(0), min: 0, max: 0},
+		{name: "rate 1", throttler: NewProbabilisticMetricsThrottler(1), min: 8000, max: 8000},
+		{name: "rate 0", throttler: NewProbabilisticMetricsThrottler(0), min: 0, max: 0},
+		{name: "rate 0.25", throttler: NewProbabilisticMetricsThrottler(0.25), min: 1600, max: 2400},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			count := sampled(test.throttler, 8000)
+			if count < test.min || count > test.max {
+				t.Errorf("sampled requests: expected between %d and %d, received %d", test.min, test.max, count)
+			}
+		})
+	}
+
+	t.Run("frequency", func(t *testing.T) {
+		throttler := NewDefaultMetricsThrottler(20 * time.Millisecond)
+		var count int64
+		for start := time.Now(); time.Since(start) < 110*time.Millisecond; {
+			count += sampled(throttler, 80)
+		}
+		// Once per 20ms over 110ms, with room for a slow scheduler.
+		if count < 2 || count > 5 {
+			t.Errorf("sampled requests: expected between 2 and 5, received %d", count)
+		}
+	})
+}
+
+func BenchmarkDefaultMetricsThrottler(b *testing.B) {
+	throttlers := []struct {
+		name      string
+		throttler DefaultMetricsThrottler
+	}{
+		{name: "always", throttler: DefaultMetricsThrottler{}},
+		{name: "frequency", throttler: NewDefaultMetricsThrottler(time.Millisecond)},
+		{name: "every n", throttler: NewEveryNMetricsThrottler(100)},
+		{name: "probabilistic", throttler: NewProbabilisticMetricsThrottler(0.01)},
+	}
+	for _, test := range throttlers {
+		b.Run(test.name, func(b *testing.B) {
+			b.RunParallel(func(pb *testing.PB) {
+				throttler := test.throttler
+				for pb.Next() {
+					throttler.ShouldHandle()
+				}
+			})
+		})
+	}
+}
+
+func TestHistogramMetricsHandler(t *testing.T) {
+	handler := NewHistogramMetricsHandler(DefaultMetricsThrottler{})
+	// 1ms to 1000ms, and one 10s outlier.
+	for i := 1; i <= 1000; i++ {
+		handler.HandleMetrics(Metric{Key: MetricsKeyDuring, Value: time.Duration(i) * time.Millisecond, Tract: "parse"})
+	}
+	handler.HandleMetrics(
+		Metric{Key: MetricsKeyDuring, Value: 10 * time.Second, Tract: "parse"},
+		Metric{Key: MetricsKeyIn, Value: 100 * time.Nanosecond, Tract: "parse"},
+		Metric{Key: MetricsKeyIn, Value: time.Second, Tract: "enrich"},
+		// Metrics that are not latencies are ignored.
+		Metric{Key: MetricsKeyInBuffer, Count: 3, Tract: "parse"},
+	)
+
+	// within checks that a quantile is within the histogram's 1% precision.
+	within := func(name string, expected, received time.Duration) {
+		if diff := received - expected; diff < -expected/100 || diff > expected/100 {
+			t.Errorf("%s: expected %v within 1%%, received %v", name, expected, received)
+		}
+	}
+	snapshots := handler.Snapshot()
+	if len(snapshots) != 3 {
+		t.Fatalf("snapshots: expected 3, received %+v", snapshots)
+	}
+	if s := snapshots[0]; s.Tract != "enrich" || s.Key != MetricsKeyIn || s.Count != 1 || s.Max != time.Second {
+		t.Errorf("unexpected snapshot %+v", s)
+	}
+	within("enrich p50", time.Second, snapshots[0].P50)
+	if s := snapshots[1]; s.Tract != "parse" || s.Key != MetricsKeyIn || s.P99 != 100*time.Nanosecond {
+		t.Errorf("unexpected snapshot %+v", s)
+	}
+	during := snapshots[2]
+	if during.Tract != "parse" || during.Key != MetricsKeyDuring || during.Count != 1001 || during.Max != 10*time.Second {
+		t.Errorf("unexpected snapshot %+v", during)
+	}
+	within("parse p50", 501*time.Millisecond, during.P50)
+	within("parse p90", 901*time.Millisecond, during.P90)
+	within("parse p99", 991*time.Millisecond, during.P99)
+
+	if reset := handler.Reset(); !reflect.DeepEqual(reset, snapshots) {
+		t.Errorf("reset: expected %+v, received %+v", snapshots, reset)
+	}
+	handler.HandleMetrics(Metric{Key: MetricsKeyDuring, Value: time.Millisecond, Tract: "parse"})
+	snapshots = handler.Snapshot()
+	if len(snapshots) != 1 || snapshots[0].Count != 1 || snapshots[0].Max != time.Millisecond {
+		t.Errorf("snapshots after reset: expected only the new metric, received %+v", snapshots)
+	}
+
+	// Tracts with the same name in different groups have separate histograms.
+	handler.Reset()
+	handler.HandleMetrics(
+		Metric{Key: MetricsKeyDuring, Value: time.Millisecond, Tract: "parse", Path: "pipeline/a/parse"},
+		Metric{Key: MetricsKeyDuring, Value: time.Second, Tract: "parse", Path: "pipeline/b/parse"},
+	)
+	snapshots = handler.Snapshot()
+	if len(snapshots) != 2 || snapshots[0].Path != "pipeline/a/parse" || snapshots[0].Max != time.Millisecond ||
+		snapshots[1].Path != "pipeline/b/parse" || snapshots[1].Max != time.Second {
+		t.Errorf("snapshots of tracts with the same name: expected one for each path, received %+v", snapshots)
+	}
+}
+
+func TestHistogramIndex(t *testing.T) {
+	previous := -1
+	for _, v := range []uint64{0, 1, 127, 128, 129, 255, 256, 1000, 1 << 40, 1<<63 - 1, 1<<64 - 1} {
+		i := histogramIndex(v)
+		if i < previous {
+			t.Errorf("index of %d: expected at least %d, received %d", v, previous, i)
+		}
+		previous = i
+		if upper := histogramUpperBound(i); upper < v || upper-v > v/64 {
+			t.Errorf("upper bound of the bucket of %d: received %d", v, upper)
+		}
+	}
 }
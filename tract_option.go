@@ -1,8 +1,32 @@
 package tract
 
+import "time"
+
 // WorkerTractOption is a function option applyable to worker tracts.
 type WorkerTractOption func(*workerTract)
 
+// WithInputBuffer creates a WorkerTractOption that will make the link to the tract's input from the tract
+// before it in a group hold up to @size requests, so that a momentary stall in this tract does not block the
+// tract before it. The amount of requests waiting in the buffer is reported as a MetricsKeyInBuffer metric.
+// By default links between tracts are unbuffered.
+func WithInputBuffer(size int) WorkerTractOption {
+	return func(p *workerTract) {
+		p.inputBuffer = size
+	}
+}
+
+// WithOverflowPolicy creates a WorkerTractOption that will decide what happens to requests put to the link
+// to the tract's input when it is full, which is sized by WithInputBuffer. Dropping requests instead of waiting
+// keeps a slow tract from stalling the tract before it, such as when it is one of many fan out branches.
+// Dropped requests are cleaned up as failed, and the amount dropped is reported as a MetricsKeyDropped metric.
+// With an unbuffered input, requests are dropped whenever none of the tract's workers are ready for them.
+// By default requests wait for room in the buffer.
+func WithOverflowPolicy(policy OverflowPolicy) WorkerTractOption {
+	return func(p *workerTract) {
+		p.inputOverflowPolicy = policy
+	}
+}
+
 // WithMetricsHandler creates a WorkerTractOption that will set the tract's metrics handler to the provided one.
 // By default no metrics handler is used, and thus no metrics are gathered.
 func WithMetricsHandler(mh MetricsHandler) WorkerTractOption {
@@ -22,3 +46,110 @@ func WithFactoryClosure(shouldClose bool) WorkerTractOption {
 		p.shouldCloseFactory = shouldClose
 	}
 }
+
+// WithRejectOutput creates a WorkerTractOption that will set the tract's reject output to the provided one.
+// Requests the tract's workers reject are put to the reject output instead of being cleaned up, with the name
+// of the tract and the reason attached. They can be retrieved using GetRequestRejectedBy() and GetRequestError().
+// The reject output is closed along with the tract's output. To share a reject output between multiple tracts,
+// set it on a group tract containing them with SetRejectOutput instead.
+// By default no reject output is used, and rejected requests are cleaned up as unsuccessful.
+func WithRejectOutput(out Output) WorkerTractOption {
+	return func(p *workerTract) {
+		p.rejectOutput = out
+	}
+}
+
+// WithRetry creates a WorkerTractOption that will make the tract's workers work requests again according
+// to @policy whenever they fail with an error. Each attempt is reported to the tract's metrics handler as
+// a MetricsKeyAttempt metric, and the final outcome as the usual MetricsKeyDuring and MetricsKeyError metrics.
+// By default requests are not retried.
+func WithRetry(policy RetryPolicy) WorkerTractOption {
+	return func(p *workerTract) {
+		p.retryPolicy = policy
+	}
+}
+
+// WithAutoscaling creates a WorkerTractOption that will grow and shrink the tract's amount of workers while it
+// is running, keeping it between @min and @max. The size the tract was made with is the amount of workers it
+// starts with. Every @interval, the time the workers spent waiting on the tract's input and output is checked:
+// if they mostly waited on input the tract shrinks, and if they mostly worked the tract grows. Workers waiting
+// on output are not a reason to grow, as the bottleneck is further down the line. New workers are made by the
+// tract's WorkerFactory, and retired workers are closed. The tract always keeps at least one worker, and fails to
+// initialize with ErrInvalidAutoscaling if @min is above @max or @interval is not positive.
+// By default the tract's amount of workers is fixed.
+func WithAutoscaling(min, max int, interval time.Duration) WorkerTractOption {
+	if min < 1 {
+		min = 1
+	}
+	return func(p *workerTract) {
+		p.autoscaler = &autoscaler{
+			min:      min,
+			max:      max,
+			interval: interval,
+		}
+	}
+}
+
+// WithOrdering creates a WorkerTractOption that will make the tract output requests in the same order it got them
+// from its input, even when it has many workers. Requests finished early wait for the requests before them. At most
+// @window requests can be between the oldest request not yet outputted and the newest request gotten; once that is
+// reached, the workers wait to get more requests. The window should be at least the tract's amount of workers to
+// keep them all busy. Requests the tract rejects don't hold up the requests after them.
+// By default requests are outputted as soon as they are worked.
+func WithOrdering(window int) WorkerTractOption {
+	return func(p *workerTract) {
+		p.orderingWindow = window
+	}
+}
+
+// WithBatchedOutput creates a WorkerTractOption that will make a batch tract pass along each batch as a single
+// request instead of passing along the requests in it individually. The requests in a batch request can be
+// retrieved by using GetRequestBatch(), and are cleaned up along with it. This option only applies to batch tracts.
+// By default batch tracts pass along the requests in each batch individually.
+func WithBatchedOutput(batched bool) WorkerTractOption {
+	return func(p *workerTract) {
+		p.batchedOutput = batched
+	}
+}
+
+// WithRateLimit creates a WorkerTractOption that will limit the tract to processing @rate requests per second,
+// shared across all its workers, while allowing bursts of up to @burst requests at once. Workers wait for their
+// turn before working a request, and the time they waited is reported as a MetricsKeyRateLimit metric.
+// A rate that is not positive does not limit the tract.
+// By default a tract's throughput is not limited.
+func WithRateLimit(rate float64, burst int) WorkerTractOption {
+	return func(p *workerTract) {
+		p.rateLimiter = nil
+		if rate > 0 {
+			p.rateLimiter = newRateLimiter(rate, burst)
+		}
+	}
+}
+
+// WithRequestTimeout creates a WorkerTractOption that will give each request a deadline of @timeout after it enters
+// the tract, so time spent waiting on a rate limit counts towards it. Workers can see the deadline through the
+// request's context, and should stop working it once the request is done. Requests whose deadline passes before or
+// while they are worked are not outputted; they are rejected with context.DeadlineExceeded as their error, and
+// cleaned up as failed if there is no reject output. Tracts after this one also drop the request once its deadline
+// passes. If the request already has an earlier deadline, that deadline still applies. A timeout that is not
+// positive does not give requests a deadline.
+// By default requests have no deadline.
+func WithRequestTimeout(timeout time.Duration) WorkerTractOption {
+	return func(p *workerTract) {
+		p.requestTimeout = timeout
+	}
+}
+
+// WithPanicRecovery creates a WorkerTractOption that will recover from the tract's workers panicking while
+// working a request. The request is failed with a PanicError holding the panic value and stack trace, which
+// is passed to @handler if it is not nil, and reported as a MetricsKeyPanic metric. If @replaceWorker is true,
+// the worker that panicked is closed and replaced with a new one made by the tract's WorkerFactory, in case
+// the panic left it in a bad state. Head tracts keep generating requests after a worker panics.
+// By default a worker panicking crashes the program.
+func WithPanicRecovery(handler func(Request, *PanicError), replaceWorker bool) WorkerTractOption {
+	return func(p *workerTract) {
+		p.panicRecovery = true
+		p.panicHandler = handler
+		p.replacePanickedWorkers = replaceWorker
+	}
+}
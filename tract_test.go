@@ -2,10 +2,14 @@ package tract_test
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"reflect"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"git.dev.kochava.com/ccurrin/tract"
 )
@@ -15,11 +19,18 @@ var _ tract.WorkerFactory = testWorkerFactory{}
 type testWorkerFactory struct {
 	flagMakeWorker func()
 	flagClose      func()
+	// Fails making a worker when it returns an error (optional)
+	makeWorkerError func() error
 	tract.Worker
 }
 
 func (f testWorkerFactory) MakeWorker() (tract.Worker, error) {
 	f.flagMakeWorker()
+	if f.makeWorkerError != nil {
+		if err := f.makeWorkerError(); err != nil {
+			return nil, err
+		}
+	}
 	return f.Worker, nil
 }
 
@@ -38,6 +49,30 @@ func (w testWorker) Work(r tract.Request) (tract.Request, bool) {
 
 func (w testWorker) Close() { w.flagClose() }
 
+var _ tract.MetricsHandler = testMetricsHandler{}
+
+type testMetricsHandler struct {
+	handleMetrics func(...tract.Metric)
+}
+
+func (h testMetricsHandler) HandleMetrics(metrics ...tract.Metric) {
+	h.handleMetrics(metrics...)
+}
+
+func (h testMetricsHandler) ShouldHandle() bool { return true }
+
+var _ tract.ErrorWorker = testErrorWorker{}
+
+type testErrorWorker struct {
+	work func(r tract.Request) (tract.Request, error)
+}
+
+func (w testErrorWorker) Work(r tract.Request) (tract.Request, error) {
+	return w.work(r)
+}
+
+func (w testErrorWorker) Close() {}
+
 func TestWorkerTract(t *testing.T) {
 	// 10 requests
 	workSource := []struct{}{9: {}}
@@ -915,3 +950,1988 @@ func TestTractWorker(t *testing.T) {
 	}
 	numberOfRequestCleanupsMutex.Unlock()
 }
+
+func TestStartContext(t *testing.T) {
+	var (
+		numberOfGeneratedRequests    int64
+		numberOfSuccessfulCleanups   int64
+		numberOfUnsuccessfulCleanups int64
+		tailWorkerStarted            = make(chan struct{})
+		tailWorkerStartedOnce        sync.Once
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	myTract := tract.NewSerialGroupTract("mySerialGroupTract",
+		tract.NewWorkerTract("head", 1, tract.NewFactoryFromWorker(testWorker{
+			flagClose: func() {},
+			work: func(r tract.Request) (tract.Request, bool) {
+				// This worker never signals a shutdown. Only the context can stop this tract.
+				atomic.AddInt64(&numberOfGeneratedRequests, 1)
+				return tract.AddRequestCleanup(r, func(_ tract.Request, success bool) {
+					if success {
+						atomic.AddInt64(&numberOfSuccessfulCleanups, 1)
+					} else {
+						atomic.AddInt64(&numberOfUnsuccessfulCleanups, 1)
+					}
+				}), true
+			},
+		})),
+		tract.NewWorkerTract("tail", 2, tract.NewFactoryFromWorker(testWorker{
+			flagClose: func() {},
+			work: func(r tract.Request) (tract.Request, bool) {
+				tailWorkerStartedOnce.Do(func() { close(tailWorkerStarted) })
+				// Requests generated by the head tract are derived from the tract's context.
+				<-r.Done()
+				return r, true
+			},
+		})),
+	)
+
+	err := myTract.Init()
+	if err != nil {
+		t.Errorf("unexpected error during tract initialization %v", err)
+	}
+
+	wait := tract.StartContext(ctx, myTract)
+	<-tailWorkerStarted
+	cancel()
+	wait()
+
+	var (
+		generated    = atomic.LoadInt64(&numberOfGeneratedRequests)
+		successful   = atomic.LoadInt64(&numberOfSuccessfulCleanups)
+		unsuccessful = atomic.LoadInt64(&numberOfUnsuccessfulCleanups)
+	)
+	if successful+unsuccessful != generated {
+		t.Errorf(`number of request cleanups: expected %d, received %d successful and %d unsuccessful`, generated, successful, unsuccessful)
+	}
+}
+
+func TestStartContextUserInput(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	myTract := tract.NewWorkerTract("worker", 2, tract.NewFactoryFromWorker(testWorker{
+		flagClose: func() {},
+		work: func(r tract.Request) (tract.Request, bool) {
+			return r, true
+		},
+	}))
+	// The user never closes this input. Only the context can stop this tract.
+	myTract.SetInput(tract.InputChannel(make(chan tract.Request)))
+
+	err := myTract.Init()
+	if err != nil {
+		t.Errorf("unexpected error during tract initialization %v", err)
+	}
+
+	wait := tract.StartContext(ctx, myTract)
+	cancel()
+	wait()
+}
+
+// userTract is a user implemented Tract, with only the methods the Tract interface requires.
+type userTract struct {
+	inner tract.Tract
+}
+
+func (p userTract) Name() string               { return p.inner.Name() }
+func (p userTract) Init() error                { return p.inner.Init() }
+func (p userTract) Start() func()              { return p.inner.Start() }
+func (p userTract) SetInput(in tract.Input)    { p.inner.SetInput(in) }
+func (p userTract) SetOutput(out tract.Output) { p.inner.SetOutput(out) }
+
+func TestStartContextUserTract(t *testing.T) {
+	// 10 requests
+	workSource := []struct{}{9: {}}
+	var numberOfRequestsProcessed int64
+	myTract := tract.NewSerialGroupTract("mySerialGroupTract",
+		tract.NewWorkerTract("head", 1, tract.NewFactoryFromWorker(testWorker{
+			flagClose: func() {},
+			work: func(r tract.Request) (tract.Request, bool) {
+				if len(workSource) == 0 {
+					return r, false
+				}
+				workSource = workSource[1:]
+				return r, true
+			},
+		})),
+		userTract{inner: tract.NewWorkerTract("user", 2, tract.NewFactoryFromWorker(testWorker{
+			flagClose: func() {},
+			work: func(r tract.Request) (tract.Request, bool) {
+				atomic.AddInt64(&numberOfRequestsProcessed, 1)
+				return r, true
+			},
+		}))},
+	)
+	if tract.SetRejectOutput(userTract{inner: myTract}, tract.OutputChannel(make(chan tract.Request))) {
+		t.Errorf("unexpected reject output set on a tract without SetRejectOutput")
+	}
+	// The group's reject output is set on the inner tracts that have one.
+	rejected := make(chan tract.Request)
+	if !tract.SetRejectOutput(myTract, tract.OutputChannel(rejected)) {
+		t.Errorf("reject output not set on a group tract")
+	}
+	go func() {
+		for range rejected {
+		}
+	}()
+
+	err := myTract.Init()
+	if err != nil {
+		t.Fatalf("unexpected error during tract initialization %v", err)
+	}
+	tract.StartContext(context.Background(), myTract)()
+
+	var expectedNumberOfRequestsProcessed int64 = 10
+	if numberOfRequestsProcessed != expectedNumberOfRequestsProcessed {
+		t.Errorf(`number of requests processed: expected %d, received %d`, expectedNumberOfRequestsProcessed, numberOfRequestsProcessed)
+	}
+}
+
+func TestErrorWorker(t *testing.T) {
+	type testLabel struct{}
+	// 10 requests
+	workSource := []struct{}{9: {}}
+	var (
+		testErr                 = errors.New("odd request")
+		numberOfRequestErrors   int64
+		numberOfRequestCleanups int64
+	)
+	myTract := tract.NewSerialGroupTract("mySerialGroupTract",
+		tract.NewWorkerTract("head", 1, tract.NewFactoryFromWorker(testWorker{
+			flagClose: func() {},
+			work: func(r tract.Request) (tract.Request, bool) {
+				if len(workSource) == 0 {
+					return r, false
+				}
+				workSource = workSource[1:]
+				r = context.WithValue(r, testLabel{}, len(workSource))
+				r = tract.AddRequestCleanup(r, func(req tract.Request, success bool) {
+					atomic.AddInt64(&numberOfRequestCleanups, 1)
+					err := tract.GetRequestError(req)
+					if success && err != nil {
+						t.Errorf("unexpected error on successful request: %v", err)
+					}
+					if !success {
+						if !errors.Is(err, testErr) {
+							t.Errorf("request error: expected %v, received %v", testErr, err)
+						}
+						atomic.AddInt64(&numberOfRequestErrors, 1)
+					}
+				})
+				return r, true
+			},
+		})),
+		tract.NewWorkerTract("tail", 2, tract.NewFactoryFromWorker(tract.NewWorkerFromErrorWorker(testErrorWorker{
+			work: func(r tract.Request) (tract.Request, error) {
+				if label, _ := r.Value(testLabel{}).(int); label%2 == 1 {
+					return r, testErr
+				}
+				return r, nil
+			},
+		}))),
+	)
+
+	err := myTract.Init()
+	if err != nil {
+		t.Errorf("unexpected error during tract initialization %v", err)
+	}
+	myTract.Start()()
+
+	var (
+		expectedNumberOfRequestCleanups int64 = 10
+		expectedNumberOfRequestErrors   int64 = 5
+	)
+	if numberOfRequestCleanups != expectedNumberOfRequestCleanups {
+		t.Errorf(`number of request cleanups: expected %d, received %d`, expectedNumberOfRequestCleanups, numberOfRequestCleanups)
+	}
+	if numberOfRequestErrors != expectedNumberOfRequestErrors {
+		t.Errorf(`number of request errors: expected %d, received %d`, expectedNumberOfRequestErrors, numberOfRequestErrors)
+	}
+}
+
+func TestRequestCleanupOrder(t *testing.T) {
+	var order []int
+	r := context.Background()
+	for i := 1; i <= 3; i++ {
+		i := i
+		r = tract.AddRequestCleanup(r, func(tract.Request, bool) {
+			order = append(order, i)
+		})
+	}
+
+	// A tract worker gets its requests back once the cleanups added within its tract have run.
+	innerTract := tract.NewWorkerTract("inner", 1, tract.NewFactoryFromWorker(testWorker{
+		flagClose: func() {},
+		work: func(r tract.Request) (tract.Request, bool) {
+			return tract.AddRequestCleanup(r, func(tract.Request, bool) {
+				order = append(order, 0)
+			}), true
+		},
+	}))
+	factory := tract.NewTractWorkerFactory(innerTract)
+	worker, err := factory.MakeWorker()
+	if err != nil {
+		t.Fatalf("unexpected error making worker %v", err)
+	}
+	r, _ = worker.Work(r)
+	worker.Close()
+	factory.Close()
+
+	tract.CleanupRequest(r, true)
+	expectedOrder := []int{0, 1, 2, 3}
+	if !reflect.DeepEqual(order, expectedOrder) {
+		t.Errorf("cleanup order: expected %v, received %v", expectedOrder, order)
+	}
+}
+
+func TestErrorWorkerNilRequest(t *testing.T) {
+	type testLabel struct{}
+	testErr := errors.New("failed without a request")
+	worker := tract.NewWorkerFromErrorWorker(testErrorWorker{
+		work: func(r tract.Request) (tract.Request, error) {
+			return nil, testErr
+		},
+	})
+
+	r, shouldSend := worker.Work(context.WithValue(context.Background(), testLabel{}, 1))
+	if shouldSend {
+		t.Errorf("unexpected should send for a failed request")
+	}
+	if label, _ := r.Value(testLabel{}).(int); label != 1 {
+		t.Errorf("request label: expected 1, received %d", label)
+	}
+	if err := tract.GetRequestError(r); err != testErr {
+		t.Errorf("request error: expected %v, received %v", testErr, err)
+	}
+}
+
+func TestRejectOutput(t *testing.T) {
+	type testLabel struct{}
+	// 10 requests
+	workSource := []struct{}{9: {}}
+	myTract := tract.NewSerialGroupTract("mySerialGroupTract",
+		tract.NewWorkerTract("head", 1, tract.NewFactoryFromWorker(testWorker{
+			flagClose: func() {},
+			work: func(r tract.Request) (tract.Request, bool) {
+				if len(workSource) == 0 {
+					return r, false
+				}
+				workSource = workSource[1:]
+				return context.WithValue(r, testLabel{}, len(workSource)), true
+			},
+		})),
+		tract.NewWorkerTract("tail", 2, tract.NewFactoryFromWorker(testWorker{
+			flagClose: func() {},
+			work: func(r tract.Request) (tract.Request, bool) {
+				label, _ := r.Value(testLabel{}).(int)
+				return r, label%2 == 0
+			},
+		})),
+	)
+	rejected := make(chan tract.Request)
+	tract.SetRejectOutput(myTract, tract.OutputChannel(rejected))
+
+	err := myTract.Init()
+	if err != nil {
+		t.Errorf("unexpected error during tract initialization %v", err)
+	}
+
+	wait := myTract.Start()
+	var numberOfRejectedRequests int
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// The group closes the reject output once all of its inner tracts are finished.
+		for r := range rejected {
+			numberOfRejectedRequests++
+			if label, _ := r.Value(testLabel{}).(int); label%2 == 0 {
+				t.Errorf("unexpected rejected request %d", label)
+			}
+			if name := tract.GetRequestRejectedBy(r); name != "tail" {
+				t.Errorf("rejected by: expected %q, received %q", "tail", name)
+			}
+			if err := tract.GetRequestError(r); err != tract.ErrRequestRejected {
+				t.Errorf("request error: expected %v, received %v", tract.ErrRequestRejected, err)
+			}
+		}
+	}()
+	wait()
+	<-done
+
+	expectedNumberOfRejectedRequests := 5
+	if numberOfRejectedRequests != expectedNumberOfRejectedRequests {
+		t.Errorf(`number of rejected requests: expected %d, received %d`, expectedNumberOfRejectedRequests, numberOfRejectedRequests)
+	}
+}
+
+func TestWithRetry(t *testing.T) {
+	tests := []struct {
+		name                     string
+		maxAttempts              int
+		expectedAttempts         int
+		expectedSuccess          bool
+		expectedNumberOfRequests int64
+	}{
+		{name: "succeeds", maxAttempts: 5, expectedAttempts: 3, expectedSuccess: true, expectedNumberOfRequests: 10},
+		{name: "exhausted", maxAttempts: 2, expectedAttempts: 2, expectedSuccess: false, expectedNumberOfRequests: 10},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// 10 requests
+			workSource := []struct{}{9: {}}
+			var (
+				testErr                 = errors.New("not yet")
+				numberOfRequestCleanups int64
+			)
+			myTract := tract.NewSerialGroupTract("mySerialGroupTract",
+				tract.NewWorkerTract("head", 1, tract.NewFactoryFromWorker(testWorker{
+					flagClose: func() {},
+					work: func(r tract.Request) (tract.Request, bool) {
+						if len(workSource) == 0 {
+							return r, false
+						}
+						workSource = workSource[1:]
+						return tract.AddRequestCleanup(r, func(req tract.Request, success bool) {
+							atomic.AddInt64(&numberOfRequestCleanups, 1)
+							if success != test.expectedSuccess {
+								t.Errorf("request success: expected %t, received %t", test.expectedSuccess, success)
+							}
+							if attempts := tract.GetRequestAttempts(req); attempts != test.expectedAttempts {
+								t.Errorf("request attempts: expected %d, received %d", test.expectedAttempts, attempts)
+							}
+						}), true
+					},
+				})),
+				tract.NewWorkerTract("tail", 2, tract.NewFactoryFromWorker(tract.NewWorkerFromErrorWorker(testErrorWorker{
+					work: func(r tract.Request) (tract.Request, error) {
+						if tract.GetRequestAttempts(r) < 3 {
+							return r, testErr
+						}
+						return r, nil
+					},
+				})), tract.WithRetry(tract.NewMaxAttemptsRetryPolicy(test.maxAttempts, tract.NewFixedRetryPolicy(0)))),
+			)
+
+			err := myTract.Init()
+			if err != nil {
+				t.Errorf("unexpected error during tract initialization %v", err)
+			}
+			myTract.Start()()
+
+			if numberOfRequestCleanups != test.expectedNumberOfRequests {
+				t.Errorf(`number of request cleanups: expected %d, received %d`, test.expectedNumberOfRequests, numberOfRequestCleanups)
+			}
+		})
+	}
+}
+
+func TestRetryPolicies(t *testing.T) {
+	tests := []struct {
+		name            string
+		policy          tract.RetryPolicy
+		attempts        int
+		elapsed         time.Duration
+		expectedBackoff time.Duration
+		expectedRetry   bool
+	}{
+		{name: "fixed", policy: tract.NewFixedRetryPolicy(time.Second), attempts: 7, expectedBackoff: time.Second, expectedRetry: true},
+		{name: "exponential first", policy: tract.NewExponentialRetryPolicy(time.Second, time.Minute, 0), attempts: 1, expectedBackoff: time.Second, expectedRetry: true},
+		{name: "exponential third", policy: tract.NewExponentialRetryPolicy(time.Second, time.Minute, 0), attempts: 3, expectedBackoff: 4 * time.Second, expectedRetry: true},
+		{name: "exponential max", policy: tract.NewExponentialRetryPolicy(time.Second, time.Minute, 0), attempts: 10, expectedBackoff: time.Minute, expectedRetry: true},
+		{name: "max attempts under", policy: tract.NewMaxAttemptsRetryPolicy(3, tract.NewFixedRetryPolicy(time.Second)), attempts: 2, expectedBackoff: time.Second, expectedRetry: true},
+		{name: "max attempts reached", policy: tract.NewMaxAttemptsRetryPolicy(3, tract.NewFixedRetryPolicy(time.Second)), attempts: 3, expectedBackoff: 0, expectedRetry: false},
+		{name: "max elapsed under", policy: tract.NewMaxElapsedTimeRetryPolicy(time.Minute, tract.NewFixedRetryPolicy(time.Second)), elapsed: 30 * time.Second, expectedBackoff: time.Second, expectedRetry: true},
+		{name: "max elapsed reached", policy: tract.NewMaxElapsedTimeRetryPolicy(time.Minute, tract.NewFixedRetryPolicy(time.Second)), elapsed: time.Minute, expectedBackoff: 0, expectedRetry: false},
+	}
+	for _, test := range tests {
+		backoff, retry := test.policy.Backoff(test.attempts, test.elapsed)
+		if backoff != test.expectedBackoff || retry != test.expectedRetry {
+			t.Errorf("%s: expected (%v, %t), received (%v, %t)", test.name, test.expectedBackoff, test.expectedRetry, backoff, retry)
+		}
+	}
+}
+
+func TestWithAutoscaling(t *testing.T) {
+	// 200 requests
+	workSource := []struct{}{199: {}}
+	var (
+		numberOfMadeWorkers          int64
+		numberOfWorkersClosed        int64
+		numberOfWorkingWorkers       int64
+		maxNumberOfWorkingWorkers    int64
+		numberOfRequestsProcessed    int64
+		maxNumberOfWorkingWorkersMux sync.Mutex
+	)
+	myTract := tract.NewSerialGroupTract("mySerialGroupTract",
+		tract.NewWorkerTract("head", 1, tract.NewFactoryFromWorker(testWorker{
+			flagClose: func() {},
+			work: func(r tract.Request) (tract.Request, bool) {
+				if len(workSource) == 0 {
+					return r, false
+				}
+				workSource = workSource[1:]
+				return r, true
+			},
+		})),
+		tract.NewWorkerTract("tail", 1, testWorkerFactory{
+			flagMakeWorker: func() { atomic.AddInt64(&numberOfMadeWorkers, 1) },
+			flagClose:      func() {},
+			Worker: testWorker{
+				flagClose: func() { atomic.AddInt64(&numberOfWorkersClosed, 1) },
+				work: func(r tract.Request) (tract.Request, bool) {
+					working := atomic.AddInt64(&numberOfWorkingWorkers, 1)
+					maxNumberOfWorkingWorkersMux.Lock()
+					if working > maxNumberOfWorkingWorkers {
+						maxNumberOfWorkingWorkers = working
+					}
+					maxNumberOfWorkingWorkersMux.Unlock()
+					// The workers are the bottleneck of this tract.
+					time.Sleep(2 * time.Millisecond)
+					atomic.AddInt64(&numberOfWorkingWorkers, -1)
+					atomic.AddInt64(&numberOfRequestsProcessed, 1)
+					return r, true
+				},
+			},
+		}, tract.WithAutoscaling(1, 4, 10*time.Millisecond)),
+	)
+
+	err := myTract.Init()
+	if err != nil {
+		t.Errorf("unexpected error during tract initialization %v", err)
+	}
+	myTract.Start()()
+
+	var expectedNumberOfRequestsProcessed int64 = 200
+	if numberOfRequestsProcessed != expectedNumberOfRequestsProcessed {
+		t.Errorf(`number of requests processed: expected %d, received %d`, expectedNumberOfRequestsProcessed, numberOfRequestsProcessed)
+	}
+	if maxNumberOfWorkingWorkers <= 1 || maxNumberOfWorkingWorkers > 4 {
+		t.Errorf(`max number of working workers: expected between 2 and 4, received %d`, maxNumberOfWorkingWorkers)
+	}
+	if numberOfWorkersClosed != numberOfMadeWorkers {
+		t.Errorf(`number of worker closures: expected %d, received %d`, numberOfMadeWorkers, numberOfWorkersClosed)
+	}
+}
+
+func TestWithAutoscalingIdle(t *testing.T) {
+	myTract := tract.NewWorkerTract("idle", 2, tract.NewFactoryFromWorker(testWorker{
+		flagClose: func() {},
+		work: func(r tract.Request) (tract.Request, bool) {
+			return r, true
+		},
+	}), tract.WithAutoscaling(0, 4, time.Millisecond))
+	input := make(chan tract.Request)
+	output := make(chan tract.Request)
+	myTract.SetInput(tract.InputChannel(input))
+	myTract.SetOutput(tract.OutputChannel(output))
+
+	err := myTract.Init()
+	if err != nil {
+		t.Fatalf("unexpected error during tract initialization %v", err)
+	}
+	wait := myTract.Start()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		wait()
+	}()
+
+	// The tract is idle between requests long enough to shrink, but must keep a worker to get the next one.
+	for i := 0; i < 10; i++ {
+		time.Sleep(5 * time.Millisecond)
+		select {
+		case <-done:
+			t.Fatalf("tract finished after %d of 10 requests while its input was open", i)
+		case input <- context.Background():
+		}
+		<-output
+	}
+	close(input)
+	<-done
+
+	for _, option := range []tract.WorkerTractOption{
+		tract.WithAutoscaling(4, 2, time.Millisecond),
+		tract.WithAutoscaling(1, 2, 0),
+	} {
+		invalidTract := tract.NewWorkerTract("invalid", 1, tract.NewFactoryFromWorker(testWorker{
+			flagClose: func() {},
+		}), option)
+		if err := invalidTract.Init(); !errors.Is(err, tract.ErrInvalidAutoscaling) {
+			t.Errorf("initialization error: expected %v, received %v", tract.ErrInvalidAutoscaling, err)
+		}
+	}
+}
+
+func TestWithOrdering(t *testing.T) {
+	type testLabel struct{}
+	// 100 requests
+	workSource := []struct{}{99: {}}
+	var results []int
+	myTract := tract.NewSerialGroupTract("mySerialGroupTract",
+		tract.NewWorkerTract("head", 1, tract.NewFactoryFromWorker(testWorker{
+			flagClose: func() {},
+			work: func(r tract.Request) (tract.Request, bool) {
+				if len(workSource) == 0 {
+					return r, false
+				}
+				label := 100 - len(workSource)
+				workSource = workSource[1:]
+				return context.WithValue(r, testLabel{}, label), true
+			},
+		})),
+		tract.NewWorkerTract("middle", 4, tract.NewFactoryFromWorker(testWorker{
+			flagClose: func() {},
+			work: func(r tract.Request) (tract.Request, bool) {
+				label, _ := r.Value(testLabel{}).(int)
+				// Finish requests out of order.
+				time.Sleep(time.Duration((label*7)%5) * 100 * time.Microsecond)
+				return r, label%10 != 3
+			},
+		}), tract.WithOrdering(8)),
+		tract.NewWorkerTract("tail", 1, tract.NewFactoryFromWorker(testWorker{
+			flagClose: func() {},
+			work: func(r tract.Request) (tract.Request, bool) {
+				label, _ := r.Value(testLabel{}).(int)
+				results = append(results, label)
+				return r, true
+			},
+		})),
+	)
+
+	err := myTract.Init()
+	if err != nil {
+		t.Errorf("unexpected error during tract initialization %v", err)
+	}
+	myTract.Start()()
+
+	expectedResults := []int{}
+	for i := 0; i < 100; i++ {
+		if i%10 != 3 {
+			expectedResults = append(expectedResults, i)
+		}
+	}
+	if !reflect.DeepEqual(results, expectedResults) {
+		t.Errorf("results: expected %v, received %v", expectedResults, results)
+	}
+}
+
+var _ tract.BatchWorker = testBatchWorker{}
+
+type testBatchWorker struct {
+	work func(batch []tract.Request) ([]tract.Request, []bool)
+}
+
+func (w testBatchWorker) Work(batch []tract.Request) ([]tract.Request, []bool) {
+	return w.work(batch)
+}
+
+func (w testBatchWorker) Close() {}
+
+func TestBatchTract(t *testing.T) {
+	type testLabel struct{}
+	tests := []struct {
+		name    string
+		options []tract.WorkerTractOption
+		// The batch worker leaves the requests it doesn't send out of the batch it returns.
+		filter                    bool
+		expectedNumberOfTailWorks int64
+	}{
+		{name: "individual", expectedNumberOfTailWorks: 9},
+		{name: "batched", options: []tract.WorkerTractOption{tract.WithBatchedOutput(true)}, expectedNumberOfTailWorks: 4},
+		{name: "filtered", filter: true, expectedNumberOfTailWorks: 9},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// 10 requests
+			workSource := []struct{}{9: {}}
+			var (
+				batchSizes                   []int
+				numberOfTailWorks            int64
+				numberOfSuccessfulCleanups   int64
+				numberOfUnsuccessfulCleanups int64
+			)
+			myTract := tract.NewSerialGroupTract("mySerialGroupTract",
+				tract.NewWorkerTract("head", 1, tract.NewFactoryFromWorker(testWorker{
+					flagClose: func() {},
+					work: func(r tract.Request) (tract.Request, bool) {
+						if len(workSource) == 0 {
+							return r, false
+						}
+						workSource = workSource[1:]
+						r = context.WithValue(r, testLabel{}, len(workSource))
+						return tract.AddRequestCleanup(r, func(_ tract.Request, success bool) {
+							if success {
+								atomic.AddInt64(&numberOfSuccessfulCleanups, 1)
+							} else {
+								atomic.AddInt64(&numberOfUnsuccessfulCleanups, 1)
+							}
+						}), true
+					},
+				})),
+				tract.NewBatchTract("batch", 1, 3, 0, tract.NewBatchFactoryFromWorker(testBatchWorker{
+					work: func(batch []tract.Request) ([]tract.Request, []bool) {
+						batchSizes = append(batchSizes, len(batch))
+						if test.filter {
+							var (
+								filtered   []tract.Request
+								shouldSend []bool
+							)
+							for _, r := range batch {
+								if label, _ := r.Value(testLabel{}).(int); label != 4 {
+									filtered = append(filtered, r)
+									shouldSend = append(shouldSend, true)
+								}
+							}
+							return filtered, shouldSend
+						}
+						shouldSend := make([]bool, len(batch))
+						for i, r := range batch {
+							label, _ := r.Value(testLabel{}).(int)
+							shouldSend[i] = label != 4
+						}
+						return batch, shouldSend
+					},
+				}), test.options...),
+				tract.NewWorkerTract("tail", 1, tract.NewFactoryFromWorker(testWorker{
+					flagClose: func() {},
+					work: func(r tract.Request) (tract.Request, bool) {
+						numberOfTailWorks++
+						return r, true
+					},
+				})),
+			)
+
+			err := myTract.Init()
+			if err != nil {
+				t.Errorf("unexpected error during tract initialization %v", err)
+			}
+			myTract.Start()()
+
+			var (
+				expectedBatchSizes                         = []int{3, 3, 3, 1}
+				expectedNumberOfSuccessfulCleanups   int64 = 9
+				expectedNumberOfUnsuccessfulCleanups int64 = 1
+			)
+			if !reflect.DeepEqual(batchSizes, expectedBatchSizes) {
+				t.Errorf("batch sizes: expected %v, received %v", expectedBatchSizes, batchSizes)
+			}
+			if numberOfTailWorks != test.expectedNumberOfTailWorks {
+				t.Errorf(`number of tail works: expected %d, received %d`, test.expectedNumberOfTailWorks, numberOfTailWorks)
+			}
+			if numberOfSuccessfulCleanups != expectedNumberOfSuccessfulCleanups {
+				t.Errorf(`number of successful cleanups: expected %d, received %d`, expectedNumberOfSuccessfulCleanups, numberOfSuccessfulCleanups)
+			}
+			if numberOfUnsuccessfulCleanups != expectedNumberOfUnsuccessfulCleanups {
+				t.Errorf(`number of unsuccessful cleanups: expected %d, received %d`, expectedNumberOfUnsuccessfulCleanups, numberOfUnsuccessfulCleanups)
+			}
+		})
+	}
+
+	// Batch tracts have no way to generate requests of their own.
+	headTract := tract.NewBatchTract("batch", 1, 3, 0, tract.NewBatchFactoryFromWorker(testBatchWorker{}))
+	err := headTract.Init()
+	var initErr *tract.InitError
+	if !errors.As(err, &initErr) || initErr.Path != "batch" || !errors.Is(err, tract.ErrBatchAsHead) {
+		t.Errorf("initialization error: expected %v from %q, received %v", tract.ErrBatchAsHead, "batch", err)
+	}
+}
+
+func TestBatchTractStartContext(t *testing.T) {
+	var (
+		numberOfGeneratedRequests    int64
+		numberOfSuccessfulCleanups   int64
+		numberOfUnsuccessfulCleanups int64
+		batchWorkerStarted           = make(chan struct{})
+		batchWorkerStartedOnce       sync.Once
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	myTract := tract.NewSerialGroupTract("mySerialGroupTract",
+		tract.NewWorkerTract("head", 1, tract.NewFactoryFromWorker(testWorker{
+			flagClose: func() {},
+			work: func(r tract.Request) (tract.Request, bool) {
+				// This worker never signals a shutdown. Only the context can stop this tract.
+				atomic.AddInt64(&numberOfGeneratedRequests, 1)
+				return tract.AddRequestCleanup(r, func(_ tract.Request, success bool) {
+					if success {
+						atomic.AddInt64(&numberOfSuccessfulCleanups, 1)
+					} else {
+						atomic.AddInt64(&numberOfUnsuccessfulCleanups, 1)
+					}
+				}), true
+			},
+		})),
+		tract.NewBatchTract("batch", 1, 2, 0, tract.NewBatchFactoryFromWorker(testBatchWorker{
+			work: func(batch []tract.Request) ([]tract.Request, []bool) {
+				batchWorkerStartedOnce.Do(func() { close(batchWorkerStarted) })
+				// Requests generated by the head tract are derived from the tract's context.
+				<-batch[0].Done()
+				shouldSend := make([]bool, len(batch))
+				for i := range shouldSend {
+					shouldSend[i] = true
+				}
+				return batch, shouldSend
+			},
+		})),
+	)
+
+	err := myTract.Init()
+	if err != nil {
+		t.Errorf("unexpected error during tract initialization %v", err)
+	}
+
+	wait := tract.StartContext(ctx, myTract)
+	<-batchWorkerStarted
+	// Let the head tract fill the batch tract's input while the batch worker waits.
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		wait()
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("tract did not finish after its context was cancelled")
+	}
+
+	var (
+		generated    = atomic.LoadInt64(&numberOfGeneratedRequests)
+		successful   = atomic.LoadInt64(&numberOfSuccessfulCleanups)
+		unsuccessful = atomic.LoadInt64(&numberOfUnsuccessfulCleanups)
+	)
+	if successful+unsuccessful != generated {
+		t.Errorf(`number of request cleanups: expected %d, received %d successful and %d unsuccessful`, generated, successful, unsuccessful)
+	}
+}
+
+func TestWithRateLimit(t *testing.T) {
+	// 20 requests
+	workSource := []struct{}{19: {}}
+	var numberOfRequestsProcessed int64
+	myTract := tract.NewSerialGroupTract("mySerialGroupTract",
+		tract.NewWorkerTract("head", 1, tract.NewFactoryFromWorker(testWorker{
+			flagClose: func() {},
+			work: func(r tract.Request) (tract.Request, bool) {
+				if len(workSource) == 0 {
+					return r, false
+				}
+				workSource = workSource[1:]
+				return r, true
+			},
+		})),
+		tract.NewWorkerTract("limited", 4, tract.NewFactoryFromWorker(testWorker{
+			flagClose: func() {},
+			work: func(r tract.Request) (tract.Request, bool) {
+				atomic.AddInt64(&numberOfRequestsProcessed, 1)
+				return r, true
+			},
+		}), tract.WithRateLimit(200, 5)),
+	)
+
+	err := myTract.Init()
+	if err != nil {
+		t.Errorf("unexpected error during tract initialization %v", err)
+	}
+	start := time.Now()
+	myTract.Start()()
+	elapsed := time.Since(start)
+
+	var expectedNumberOfRequestsProcessed int64 = 20
+	if numberOfRequestsProcessed != expectedNumberOfRequestsProcessed {
+		t.Errorf(`number of requests processed: expected %d, received %d`, expectedNumberOfRequestsProcessed, numberOfRequestsProcessed)
+	}
+	// The first 5 requests burst through, and the other 15 are limited to 200 per second.
+	expectedMinimumElapsed := 15 * time.Second / 200
+	if elapsed < expectedMinimumElapsed {
+		t.Errorf("elapsed time: expected at least %v, received %v", expectedMinimumElapsed, elapsed)
+	}
+}
+
+func TestWithRequestTimeout(t *testing.T) {
+	type testLabel struct{}
+	// 10 requests
+	workSource := []struct{}{9: {}}
+	var numberOfRequestsProcessed int64
+	myTract := tract.NewSerialGroupTract("mySerialGroupTract",
+		tract.NewWorkerTract("head", 1, tract.NewFactoryFromWorker(testWorker{
+			flagClose: func() {},
+			work: func(r tract.Request) (tract.Request, bool) {
+				if len(workSource) == 0 {
+					return r, false
+				}
+				workSource = workSource[1:]
+				if _, ok := r.Deadline(); !ok {
+					t.Errorf("expected request to have a deadline")
+				}
+				return context.WithValue(r, testLabel{}, len(workSource)), true
+			},
+		}), tract.WithRequestTimeout(50*time.Millisecond)),
+		tract.NewWorkerTract("slow", 10, tract.NewFactoryFromWorker(testWorker{
+			flagClose: func() {},
+			work: func(r tract.Request) (tract.Request, bool) {
+				// Odd requests take longer than their deadline.
+				if label, _ := r.Value(testLabel{}).(int); label%2 == 1 {
+					<-r.Done()
+				}
+				return r, true
+			},
+		})),
+		tract.NewWorkerTract("tail", 1, tract.NewFactoryFromWorker(testWorker{
+			flagClose: func() {},
+			work: func(r tract.Request) (tract.Request, bool) {
+				if label, _ := r.Value(testLabel{}).(int); label%2 == 1 {
+					t.Errorf("unexpected timed out request %d", label)
+				}
+				numberOfRequestsProcessed++
+				return r, true
+			},
+		})),
+	)
+	rejected := make(chan tract.Request)
+	tract.SetRejectOutput(myTract, tract.OutputChannel(rejected))
+
+	err := myTract.Init()
+	if err != nil {
+		t.Errorf("unexpected error during tract initialization %v", err)
+	}
+
+	wait := myTract.Start()
+	var numberOfRejectedRequests int
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for r := range rejected {
+			numberOfRejectedRequests++
+			if name := tract.GetRequestRejectedBy(r); name != "slow" {
+				t.Errorf("rejected by: expected %q, received %q", "slow", name)
+			}
+			if err := tract.GetRequestError(r); err != context.DeadlineExceeded {
+				t.Errorf("request error: expected %v, received %v", context.DeadlineExceeded, err)
+			}
+		}
+	}()
+	wait()
+	<-done
+
+	var expectedNumberOfRequestsProcessed int64 = 5
+	if numberOfRequestsProcessed != expectedNumberOfRequestsProcessed {
+		t.Errorf(`number of requests processed: expected %d, received %d`, expectedNumberOfRequestsProcessed, numberOfRequestsProcessed)
+	}
+	expectedNumberOfRejectedRequests := 5
+	if numberOfRejectedRequests != expectedNumberOfRejectedRequests {
+		t.Errorf(`number of rejected requests: expected %d, received %d`, expectedNumberOfRejectedRequests, numberOfRejectedRequests)
+	}
+}
+
+func TestWithRequestTimeoutRateLimit(t *testing.T) {
+	var numberOfRequestsProcessed int64
+	myTract := tract.NewWorkerTract("limited", 1, tract.NewFactoryFromWorker(testWorker{
+		flagClose: func() {},
+		work: func(r tract.Request) (tract.Request, bool) {
+			numberOfRequestsProcessed++
+			return r, true
+		},
+	}), tract.WithRateLimit(10, 1), tract.WithRequestTimeout(30*time.Millisecond))
+	input := make(chan tract.Request, 3)
+	for i := 0; i < cap(input); i++ {
+		input <- context.Background()
+	}
+	close(input)
+	myTract.SetInput(tract.InputChannel(input))
+	myTract.SetOutput(tract.OutputChannel(make(chan tract.Request, 3)))
+	rejected := make(chan tract.Request, 3)
+	tract.SetRejectOutput(myTract, tract.OutputChannel(rejected))
+
+	err := myTract.Init()
+	if err != nil {
+		t.Fatalf("unexpected error during tract initialization %v", err)
+	}
+	myTract.Start()()
+
+	// Requests after the first wait on the rate limit longer than their deadline.
+	var expectedNumberOfRequestsProcessed int64 = 1
+	if numberOfRequestsProcessed != expectedNumberOfRequestsProcessed {
+		t.Errorf(`number of requests processed: expected %d, received %d`, expectedNumberOfRequestsProcessed, numberOfRequestsProcessed)
+	}
+	expectedNumberOfRejectedRequests := 2
+	if len(rejected) != expectedNumberOfRejectedRequests {
+		t.Fatalf(`number of rejected requests: expected %d, received %d`, expectedNumberOfRejectedRequests, len(rejected))
+	}
+	for i := 0; i < expectedNumberOfRejectedRequests; i++ {
+		if err := tract.GetRequestError(<-rejected); err != context.DeadlineExceeded {
+			t.Errorf("request error: expected %v, received %v", context.DeadlineExceeded, err)
+		}
+	}
+}
+
+func TestRouterGroupTract(t *testing.T) {
+	type testLabel struct{}
+	// 30 requests
+	workSource := []struct{}{29: {}}
+	var (
+		numberOfRoutedRequestsProcessed = [3]int64{}
+		numberOfTailRequestsProcessed   int64
+	)
+	routedWorker := func(branch int) tract.Worker {
+		return testWorker{
+			flagClose: func() {},
+			work: func(r tract.Request) (tract.Request, bool) {
+				if label, _ := r.Value(testLabel{}).(int); label%3 != branch {
+					t.Errorf("unexpected request %d routed to branch %d", label, branch)
+				}
+				atomic.AddInt64(&numberOfRoutedRequestsProcessed[branch], 1)
+				return r, true
+			},
+		}
+	}
+	myTract := tract.NewSerialGroupTract("mySerialGroupTract",
+		tract.NewWorkerTract("head", 1, tract.NewFactoryFromWorker(testWorker{
+			flagClose: func() {},
+			work: func(r tract.Request) (tract.Request, bool) {
+				if len(workSource) == 0 {
+					return r, false
+				}
+				workSource = workSource[1:]
+				return context.WithValue(r, testLabel{}, len(workSource)), true
+			},
+		})),
+		tract.NewRouterGroupTract("myRouterGroupTract",
+			func(r tract.Request) int {
+				label, _ := r.Value(testLabel{}).(int)
+				return label % 3
+			},
+			// Requests routed to 2 are outside of the inner tracts, so they go to the default tract.
+			tract.NewWorkerTract("default", 1, tract.NewFactoryFromWorker(routedWorker(2))),
+			tract.NewWorkerTract("middle0", 2, tract.NewFactoryFromWorker(routedWorker(0))),
+			tract.NewWorkerTract("middle1", 4, tract.NewFactoryFromWorker(routedWorker(1))),
+		),
+		tract.NewWorkerTract("tail", 1, tract.NewFactoryFromWorker(testWorker{
+			flagClose: func() {},
+			work: func(r tract.Request) (tract.Request, bool) {
+				numberOfTailRequestsProcessed++
+				return r, true
+			},
+		})),
+	)
+
+	err := myTract.Init()
+	if err != nil {
+		t.Errorf("unexpected error during tract initialization %v", err)
+	}
+	myTract.Start()()
+
+	for branch, numberOfRequestsProcessed := range numberOfRoutedRequestsProcessed {
+		var expectedNumberOfRequestsProcessed int64 = 10
+		if numberOfRequestsProcessed != expectedNumberOfRequestsProcessed {
+			t.Errorf(`number of requests processed by branch %d: expected %d, received %d`, branch, expectedNumberOfRequestsProcessed, numberOfRequestsProcessed)
+		}
+	}
+	var expectedNumberOfTailRequestsProcessed int64 = 30
+	if numberOfTailRequestsProcessed != expectedNumberOfTailRequestsProcessed {
+		t.Errorf(`number of tail requests processed: expected %d, received %d`, expectedNumberOfTailRequestsProcessed, numberOfTailRequestsProcessed)
+	}
+}
+
+func TestShardedGroupTract(t *testing.T) {
+	type testKey struct{}
+	type testLabel struct{}
+	// 100 requests
+	workSource := []struct{}{99: {}}
+	var (
+		shardsMutex sync.Mutex
+		// The shard each key was worked by
+		keyShards = map[string]int{}
+		// The last label worked for each key
+		keyLabels = map[string]int{}
+	)
+	shardWorker := func(shard int) tract.Worker {
+		return testWorker{
+			flagClose: func() {},
+			work: func(r tract.Request) (tract.Request, bool) {
+				key, _ := r.Value(testKey{}).(string)
+				label, _ := r.Value(testLabel{}).(int)
+				shardsMutex.Lock()
+				defer shardsMutex.Unlock()
+				if keyShard, ok := keyShards[key]; ok && keyShard != shard {
+					t.Errorf("key %q: worked by shard %d and shard %d", key, keyShard, shard)
+				}
+				keyShards[key] = shard
+				if lastLabel, ok := keyLabels[key]; ok && lastLabel <= label {
+					t.Errorf("key %q: request %d worked after request %d", key, label, lastLabel)
+				}
+				keyLabels[key] = label
+				return r, true
+			},
+		}
+	}
+	myTract := tract.NewSerialGroupTract("mySerialGroupTract",
+		tract.NewWorkerTract("head", 1, tract.NewFactoryFromWorker(testWorker{
+			flagClose: func() {},
+			work: func(r tract.Request) (tract.Request, bool) {
+				if len(workSource) == 0 {
+					return r, false
+				}
+				workSource = workSource[1:]
+				r = context.WithValue(r, testKey{}, fmt.Sprintf("key%d", len(workSource)%7))
+				return context.WithValue(r, testLabel{}, len(workSource)), true
+			},
+		})),
+		tract.NewShardedGroupTract("myShardedGroupTract",
+			func(r tract.Request) string {
+				key, _ := r.Value(testKey{}).(string)
+				return key
+			},
+			tract.NewWorkerTract("shard0", 1, tract.NewFactoryFromWorker(shardWorker(0))),
+			tract.NewWorkerTract("shard1", 1, tract.NewFactoryFromWorker(shardWorker(1))),
+			tract.NewWorkerTract("shard2", 1, tract.NewFactoryFromWorker(shardWorker(2))),
+		),
+	)
+
+	err := myTract.Init()
+	if err != nil {
+		t.Errorf("unexpected error during tract initialization %v", err)
+	}
+	myTract.Start()()
+
+	expectedNumberOfKeys := 7
+	if len(keyShards) != expectedNumberOfKeys {
+		t.Errorf(`number of keys: expected %d, received %d`, expectedNumberOfKeys, len(keyShards))
+	}
+
+	// Shards with many workers could work requests with the same key concurrently.
+	invalidTract := tract.NewSerialGroupTract("pipeline",
+		tract.NewWorkerTract("head", 1, tract.NewFactoryFromWorker(shardWorker(0))),
+		tract.NewShardedGroupTract("sharded",
+			func(tract.Request) string { return "" },
+			tract.NewWorkerTract("shard0", 1, tract.NewFactoryFromWorker(shardWorker(0))),
+			tract.NewWorkerTract("shard1", 2, tract.NewFactoryFromWorker(shardWorker(1))),
+		),
+	)
+	err = invalidTract.Init()
+	if !errors.Is(err, tract.ErrShardNotSingleWorker) {
+		t.Errorf("initialization error: expected %v, received %v", tract.ErrShardNotSingleWorker, err)
+	}
+	var initErr *tract.InitError
+	if expectedPath := "pipeline/sharded/shard1"; !errors.As(err, &initErr) || initErr.Path != expectedPath {
+		t.Errorf("initialization error: expected path %q, received %v", expectedPath, err)
+	}
+}
+
+func TestFanOutJoinGroupTract(t *testing.T) {
+	type testLabel struct{}
+	type testBranch struct{}
+	testErr := errors.New("test error")
+	// 10 requests
+	workSource := []struct{}{9: {}}
+	var (
+		numberOfMergedRequestsProcessed int64
+		numberOfRequestsCleanedUp       int64
+		numberOfBranchCleanups          int64
+	)
+	myTract := tract.NewSerialGroupTract("mySerialGroupTract",
+		tract.NewWorkerTract("head", 1, tract.NewFactoryFromWorker(testWorker{
+			flagClose: func() {},
+			work: func(r tract.Request) (tract.Request, bool) {
+				if len(workSource) == 0 {
+					return r, false
+				}
+				workSource = workSource[1:]
+				r = tract.AddRequestCleanup(r, func(r tract.Request, success bool) {
+					if !success {
+						t.Errorf("unexpected failed merged request")
+					}
+					atomic.AddInt64(&numberOfRequestsCleanedUp, 1)
+				})
+				return context.WithValue(r, testLabel{}, len(workSource)), true
+			},
+		})),
+		tract.NewFanOutJoinGroupTract("myFanOutJoinGroupTract",
+			func(r tract.Request, results []tract.BranchResult) (tract.Request, bool) {
+				label, _ := r.Value(testLabel{}).(int)
+				expectedErrs := []error{nil, nil, nil, nil}
+				if label%2 == 1 {
+					expectedErrs[1] = testErr
+				}
+				if label == 0 {
+					expectedErrs[2] = tract.ErrBranchTimeout
+				}
+				for i, result := range results {
+					if result.Err != expectedErrs[i] {
+						t.Errorf("request %d branch %d: expected error %v, received %v", label, i, expectedErrs[i], result.Err)
+					}
+					if result.Err != nil {
+						continue
+					}
+					if branch, _ := result.Request.Value(testBranch{}).(int); branch != i {
+						t.Errorf("request %d branch %d: expected result from branch %d, received %d", label, i, i, branch)
+					}
+				}
+				return r, true
+			},
+			100*time.Millisecond,
+			tract.NewWorkerTract("branch0", 2, tract.NewFactoryFromWorker(testWorker{
+				flagClose: func() {},
+				work: func(r tract.Request) (tract.Request, bool) {
+					r = tract.AddRequestCleanup(r, func(tract.Request, bool) {
+						atomic.AddInt64(&numberOfBranchCleanups, 1)
+					})
+					return context.WithValue(r, testBranch{}, 0), true
+				},
+			})),
+			tract.NewWorkerTract("branch1", 2, tract.NewFactoryFromWorker(tract.NewWorkerFromErrorWorker(testErrorWorker{
+				work: func(r tract.Request) (tract.Request, error) {
+					if label, _ := r.Value(testLabel{}).(int); label%2 == 1 {
+						return r, testErr
+					}
+					return context.WithValue(r, testBranch{}, 1), nil
+				},
+			}))),
+			tract.NewWorkerTract("branch2", 2, tract.NewFactoryFromWorker(testWorker{
+				flagClose: func() {},
+				work: func(r tract.Request) (tract.Request, bool) {
+					// The last request takes longer than the join waits.
+					if label, _ := r.Value(testLabel{}).(int); label == 0 {
+						time.Sleep(300 * time.Millisecond)
+					}
+					return context.WithValue(r, testBranch{}, 2), true
+				},
+			})),
+			// A branch that fans out finishes its copy once for each of its inner tracts.
+			tract.NewFanOutGroupTract("branch3",
+				tract.NewWorkerTract("branch3a", 1, tract.NewFactoryFromWorker(testWorker{
+					flagClose: func() {},
+					work: func(r tract.Request) (tract.Request, bool) {
+						return context.WithValue(r, testBranch{}, 3), true
+					},
+				})),
+				tract.NewWorkerTract("branch3b", 1, tract.NewFactoryFromWorker(testWorker{
+					flagClose: func() {},
+					work: func(r tract.Request) (tract.Request, bool) {
+						return context.WithValue(r, testBranch{}, 3), true
+					},
+				})),
+			),
+		),
+		tract.NewWorkerTract("tail", 1, tract.NewFactoryFromWorker(testWorker{
+			flagClose: func() {},
+			work: func(r tract.Request) (tract.Request, bool) {
+				numberOfMergedRequestsProcessed++
+				return r, true
+			},
+		})),
+	)
+
+	err := myTract.Init()
+	if err != nil {
+		t.Errorf("unexpected error during tract initialization %v", err)
+	}
+	myTract.Start()()
+
+	var expectedNumberOfMergedRequestsProcessed int64 = 10
+	if numberOfMergedRequestsProcessed != expectedNumberOfMergedRequestsProcessed {
+		t.Errorf(`number of merged requests processed: expected %d, received %d`, expectedNumberOfMergedRequestsProcessed, numberOfMergedRequestsProcessed)
+	}
+	var expectedNumberOfRequestsCleanedUp int64 = 10
+	if numberOfRequestsCleanedUp != expectedNumberOfRequestsCleanedUp {
+		t.Errorf(`number of requests cleaned up: expected %d, received %d`, expectedNumberOfRequestsCleanedUp, numberOfRequestsCleanedUp)
+	}
+	var expectedNumberOfBranchCleanups int64 = 10
+	if numberOfBranchCleanups != expectedNumberOfBranchCleanups {
+		t.Errorf(`number of branch cleanups: expected %d, received %d`, expectedNumberOfBranchCleanups, numberOfBranchCleanups)
+	}
+}
+
+func TestConditionalFanOutGroupTract(t *testing.T) {
+	type testLabel struct{}
+	// 30 requests
+	workSource := []struct{}{29: {}}
+	var (
+		numberOfBranchRequestsProcessed = [2]int64{}
+		numberOfTailRequestsProcessed   int64
+		numberOfRequestsCleanedUp       [2]int64
+		numberOfBranches                = map[int64]int{}
+	)
+	divisibleBy := func(n int) func(tract.Request) bool {
+		return func(r tract.Request) bool {
+			label, _ := r.Value(testLabel{}).(int)
+			return label%n == 0
+		}
+	}
+	branchWorker := func(branch int) tract.Worker {
+		return testWorker{
+			flagClose: func() {},
+			work: func(r tract.Request) (tract.Request, bool) {
+				atomic.AddInt64(&numberOfBranchRequestsProcessed[branch], 1)
+				return r, true
+			},
+		}
+	}
+	myTract := tract.NewSerialGroupTract("mySerialGroupTract",
+		tract.NewWorkerTract("head", 1, tract.NewFactoryFromWorker(testWorker{
+			flagClose: func() {},
+			work: func(r tract.Request) (tract.Request, bool) {
+				if len(workSource) == 0 {
+					return r, false
+				}
+				workSource = workSource[1:]
+				r = tract.AddRequestCleanup(r, func(r tract.Request, success bool) {
+					if success {
+						atomic.AddInt64(&numberOfRequestsCleanedUp[1], 1)
+					} else {
+						atomic.AddInt64(&numberOfRequestsCleanedUp[0], 1)
+					}
+				})
+				return context.WithValue(r, testLabel{}, len(workSource)), true
+			},
+		})),
+		tract.NewConditionalFanOutGroupTract("myConditionalFanOutGroupTract",
+			testMetricsHandler{handleMetrics: func(metrics ...tract.Metric) {
+				for _, metric := range metrics {
+					if metric.Key == tract.MetricsKeyBranches {
+						numberOfBranches[metric.Count]++
+					}
+				}
+			}},
+			tract.FanOutBranch{
+				Tract:     tract.NewWorkerTract("divisibleBy2", 2, tract.NewFactoryFromWorker(branchWorker(0))),
+				Predicate: divisibleBy(2),
+			},
+			tract.FanOutBranch{
+				Tract:     tract.NewWorkerTract("divisibleBy3", 2, tract.NewFactoryFromWorker(branchWorker(1))),
+				Predicate: divisibleBy(3),
+			},
+		),
+		tract.NewWorkerTract("tail", 1, tract.NewFactoryFromWorker(testWorker{
+			flagClose: func() {},
+			work: func(r tract.Request) (tract.Request, bool) {
+				numberOfTailRequestsProcessed++
+				return r, true
+			},
+		})),
+	)
+
+	err := myTract.Init()
+	if err != nil {
+		t.Errorf("unexpected error during tract initialization %v", err)
+	}
+	myTract.Start()()
+
+	expectedNumberOfBranchRequestsProcessed := [2]int64{15, 10}
+	if numberOfBranchRequestsProcessed != expectedNumberOfBranchRequestsProcessed {
+		t.Errorf(`number of branch requests processed: expected %v, received %v`, expectedNumberOfBranchRequestsProcessed, numberOfBranchRequestsProcessed)
+	}
+	var expectedNumberOfTailRequestsProcessed int64 = 25
+	if numberOfTailRequestsProcessed != expectedNumberOfTailRequestsProcessed {
+		t.Errorf(`number of tail requests processed: expected %d, received %d`, expectedNumberOfTailRequestsProcessed, numberOfTailRequestsProcessed)
+	}
+	// Requests divisible by neither are cleaned up as failed, and the rest are cleaned up once per branch.
+	expectedNumberOfRequestsCleanedUp := [2]int64{10, 25}
+	if numberOfRequestsCleanedUp != expectedNumberOfRequestsCleanedUp {
+		t.Errorf(`number of requests cleaned up (failed, succeeded): expected %v, received %v`, expectedNumberOfRequestsCleanedUp, numberOfRequestsCleanedUp)
+	}
+	expectedNumberOfBranches := map[int64]int{0: 10, 1: 15, 2: 5}
+	if !reflect.DeepEqual(numberOfBranches, expectedNumberOfBranches) {
+		t.Errorf(`number of requests by number of branches: expected %v, received %v`, expectedNumberOfBranches, numberOfBranches)
+	}
+}
+
+func TestConditionalFanOutGroupTractNilPredicate(t *testing.T) {
+	// 5 requests
+	workSource := []struct{}{4: {}}
+	var numberOfBranchRequestsProcessed int64
+	myTract := tract.NewSerialGroupTract("mySerialGroupTract",
+		tract.NewWorkerTract("head", 1, tract.NewFactoryFromWorker(testWorker{
+			flagClose: func() {},
+			work: func(r tract.Request) (tract.Request, bool) {
+				if len(workSource) == 0 {
+					return r, false
+				}
+				workSource = workSource[1:]
+				return r, true
+			},
+		})),
+		tract.NewConditionalFanOutGroupTract("myConditionalFanOutGroupTract", nil,
+			// A branch without a predicate gets every request.
+			tract.FanOutBranch{
+				Tract: tract.NewWorkerTract("all", 1, tract.NewFactoryFromWorker(testWorker{
+					flagClose: func() {},
+					work: func(r tract.Request) (tract.Request, bool) {
+						numberOfBranchRequestsProcessed++
+						return r, true
+					},
+				})),
+			},
+		),
+	)
+
+	err := myTract.Init()
+	if err != nil {
+		t.Errorf("unexpected error during tract initialization %v", err)
+	}
+	myTract.Start()()
+
+	var expectedNumberOfBranchRequestsProcessed int64 = 5
+	if numberOfBranchRequestsProcessed != expectedNumberOfBranchRequestsProcessed {
+		t.Errorf(`number of branch requests processed: expected %d, received %d`, expectedNumberOfBranchRequestsProcessed, numberOfBranchRequestsProcessed)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	testErr := errors.New("test error")
+	var (
+		serviceFailing       = true
+		numberOfServiceCalls int
+		states               []tract.CircuitState
+	)
+	factory := tract.NewCircuitBreakerFactory(tract.NewFactoryFromWorker(tract.NewWorkerFromErrorWorker(testErrorWorker{
+		work: func(r tract.Request) (tract.Request, error) {
+			numberOfServiceCalls++
+			if serviceFailing {
+				return r, testErr
+			}
+			return r, nil
+		},
+	})), 0.5, 4, 50*time.Millisecond, tract.WithCircuitMetricsHandler(testMetricsHandler{
+		handleMetrics: func(metrics ...tract.Metric) {
+			for _, metric := range metrics {
+				if metric.Key == tract.MetricsKeyCircuitState {
+					states = append(states, tract.CircuitState(metric.Count))
+				}
+			}
+		},
+	}))
+	defer factory.Close()
+	worker, err := factory.MakeWorker()
+	if err != nil {
+		t.Fatalf("unexpected error making worker %v", err)
+	}
+	work := func(expectedErr error) {
+		t.Helper()
+		r, ok := worker.Work(context.Background())
+		if err := tract.GetRequestError(r); err != expectedErr || ok != (expectedErr == nil) {
+			t.Errorf("request error: expected %v, received %v (%v)", expectedErr, err, ok)
+		}
+	}
+
+	// The circuit breaker opens once half of the last 4 requests failed.
+	for i := 0; i < 4; i++ {
+		work(testErr)
+	}
+	work(tract.ErrCircuitOpen)
+	if expectedNumberOfServiceCalls := 4; numberOfServiceCalls != expectedNumberOfServiceCalls {
+		t.Errorf("number of service calls: expected %d, received %d", expectedNumberOfServiceCalls, numberOfServiceCalls)
+	}
+
+	// A failed probe opens it again.
+	time.Sleep(60 * time.Millisecond)
+	work(testErr)
+	work(tract.ErrCircuitOpen)
+
+	// A successful probe closes it.
+	serviceFailing = false
+	time.Sleep(60 * time.Millisecond)
+	work(nil)
+	work(nil)
+	if expectedNumberOfServiceCalls := 7; numberOfServiceCalls != expectedNumberOfServiceCalls {
+		t.Errorf("number of service calls: expected %d, received %d", expectedNumberOfServiceCalls, numberOfServiceCalls)
+	}
+
+	expectedStates := []tract.CircuitState{
+		tract.CircuitOpen,
+		tract.CircuitHalfOpen,
+		tract.CircuitOpen,
+		tract.CircuitHalfOpen,
+		tract.CircuitClosed,
+	}
+	if !reflect.DeepEqual(states, expectedStates) {
+		t.Errorf("circuit states: expected %v, received %v", expectedStates, states)
+	}
+}
+
+func TestCircuitBreakerThreshold(t *testing.T) {
+	testErr := errors.New("test error")
+	tests := []struct {
+		name      string
+		threshold float64
+		// Whether each request worked before checking the circuit breaker fails
+		failures     []bool
+		expectedOpen bool
+	}{
+		{name: "zero without failures", threshold: 0, failures: []bool{false, false}, expectedOpen: false},
+		{name: "zero with a failure", threshold: 0, failures: []bool{false, true}, expectedOpen: true},
+		{name: "above one with a success", threshold: 2, failures: []bool{false, true}, expectedOpen: false},
+		{name: "above one with only failures", threshold: 2, failures: []bool{true, true}, expectedOpen: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var failing bool
+			factory := tract.NewCircuitBreakerFactory(tract.NewFactoryFromWorker(tract.NewWorkerFromErrorWorker(testErrorWorker{
+				work: func(r tract.Request) (tract.Request, error) {
+					if failing {
+						return r, testErr
+					}
+					return r, nil
+				},
+			})), test.threshold, len(test.failures), time.Minute)
+			defer factory.Close()
+			worker, err := factory.MakeWorker()
+			if err != nil {
+				t.Fatalf("unexpected error making worker %v", err)
+			}
+			for _, failing = range test.failures {
+				worker.Work(context.Background())
+			}
+			failing = false
+			r, _ := worker.Work(context.Background())
+			if open := tract.GetRequestError(r) == tract.ErrCircuitOpen; open != test.expectedOpen {
+				t.Errorf("circuit open: expected %v, received %v", test.expectedOpen, open)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerPanickedProbe(t *testing.T) {
+	testErr := errors.New("test error")
+	var (
+		serviceFailing = true
+		servicePanics  = false
+	)
+	factory := tract.NewCircuitBreakerFactory(tract.NewFactoryFromWorker(tract.NewWorkerFromErrorWorker(testErrorWorker{
+		work: func(r tract.Request) (tract.Request, error) {
+			if servicePanics {
+				panic("test panic")
+			}
+			if serviceFailing {
+				return r, testErr
+			}
+			return r, nil
+		},
+	})), 1, 1, 10*time.Millisecond)
+	defer factory.Close()
+	worker, err := factory.MakeWorker()
+	if err != nil {
+		t.Fatalf("unexpected error making worker %v", err)
+	}
+	work := func(expectedErr error) {
+		t.Helper()
+		defer func() {
+			if p := recover(); p != nil && !servicePanics {
+				t.Errorf("unexpected panic %v", p)
+			}
+		}()
+		r, ok := worker.Work(context.Background())
+		if err := tract.GetRequestError(r); err != expectedErr || ok != (expectedErr == nil) {
+			t.Errorf("request error: expected %v, received %v (%v)", expectedErr, err, ok)
+		}
+	}
+
+	work(testErr)
+	work(tract.ErrCircuitOpen)
+
+	// A probe the worker panics on opens the circuit breaker again.
+	servicePanics = true
+	time.Sleep(20 * time.Millisecond)
+	work(nil)
+	servicePanics = false
+	work(tract.ErrCircuitOpen)
+
+	// The next probe is still allowed once the circuit breaker half opens.
+	serviceFailing = false
+	time.Sleep(20 * time.Millisecond)
+	work(nil)
+	work(nil)
+}
+
+func TestWithPanicRecovery(t *testing.T) {
+	type testLabel struct{}
+	// 20 requests
+	workSource := []struct{}{19: {}}
+	var (
+		numberOfMadeWorkers       int64
+		numberOfWorkersClosed     int64
+		numberOfPanicsHandled     int64
+		numberOfRequestsCleanedUp int64
+	)
+	myTract := tract.NewSerialGroupTract("mySerialGroupTract",
+		tract.NewWorkerTract("head", 1, tract.NewFactoryFromWorker(testWorker{
+			flagClose: func() {},
+			work: func(r tract.Request) (tract.Request, bool) {
+				if len(workSource) == 0 {
+					return r, false
+				}
+				workSource = workSource[1:]
+				r = tract.AddRequestCleanup(r, func(r tract.Request, success bool) {
+					if success {
+						t.Errorf("unexpected successful cleanup")
+					}
+					atomic.AddInt64(&numberOfRequestsCleanedUp, 1)
+				})
+				return context.WithValue(r, testLabel{}, len(workSource)), true
+			},
+		})),
+		tract.NewWorkerTract("panicky", 2, testWorkerFactory{
+			flagMakeWorker: func() { atomic.AddInt64(&numberOfMadeWorkers, 1) },
+			flagClose:      func() {},
+			Worker: testWorker{
+				flagClose: func() { atomic.AddInt64(&numberOfWorkersClosed, 1) },
+				work: func(r tract.Request) (tract.Request, bool) {
+					label, _ := r.Value(testLabel{}).(int)
+					if label%5 == 0 {
+						panic(label)
+					}
+					return r, false
+				},
+			},
+		}, tract.WithPanicRecovery(func(r tract.Request, err *tract.PanicError) {
+			atomic.AddInt64(&numberOfPanicsHandled, 1)
+			if label, _ := r.Value(testLabel{}).(int); err.Value != label {
+				t.Errorf("panic value: expected %v, received %v", label, err.Value)
+			}
+			if len(err.Stack) == 0 {
+				t.Errorf("expected panic stack trace")
+			}
+			if tract.GetRequestError(r) != err {
+				t.Errorf("request error: expected %v, received %v", err, tract.GetRequestError(r))
+			}
+		}, true)),
+	)
+
+	err := myTract.Init()
+	if err != nil {
+		t.Errorf("unexpected error during tract initialization %v", err)
+	}
+	myTract.Start()()
+
+	var expectedNumberOfPanicsHandled int64 = 4
+	if numberOfPanicsHandled != expectedNumberOfPanicsHandled {
+		t.Errorf(`number of panics handled: expected %d, received %d`, expectedNumberOfPanicsHandled, numberOfPanicsHandled)
+	}
+	var expectedNumberOfRequestsCleanedUp int64 = 20
+	if numberOfRequestsCleanedUp != expectedNumberOfRequestsCleanedUp {
+		t.Errorf(`number of requests cleaned up: expected %d, received %d`, expectedNumberOfRequestsCleanedUp, numberOfRequestsCleanedUp)
+	}
+	// Each worker that panicked was replaced, and every worker made was closed.
+	var expectedNumberOfMadeWorkers int64 = 2 + 4
+	if numberOfMadeWorkers != expectedNumberOfMadeWorkers {
+		t.Errorf(`number of made workers: expected %d, received %d`, expectedNumberOfMadeWorkers, numberOfMadeWorkers)
+	}
+	if numberOfWorkersClosed != expectedNumberOfMadeWorkers {
+		t.Errorf(`number of workers closed: expected %d, received %d`, expectedNumberOfMadeWorkers, numberOfWorkersClosed)
+	}
+}
+
+func TestWithPanicRecoveryHead(t *testing.T) {
+	// 10 requests
+	workSource := []struct{}{9: {}}
+	var (
+		numberOfPanics            int64
+		numberOfRequestsProcessed int64
+	)
+	myTract := tract.NewSerialGroupTract("mySerialGroupTract",
+		tract.NewWorkerTract("head", 1, tract.NewFactoryFromWorker(testWorker{
+			flagClose: func() {},
+			work: func(r tract.Request) (tract.Request, bool) {
+				if len(workSource) == 0 {
+					return r, false
+				}
+				workSource = workSource[1:]
+				if len(workSource) == 7 {
+					panic("bad record")
+				}
+				return r, true
+			},
+		}), tract.WithPanicRecovery(func(tract.Request, *tract.PanicError) {
+			atomic.AddInt64(&numberOfPanics, 1)
+		}, false)),
+		tract.NewWorkerTract("tail", 1, tract.NewFactoryFromWorker(testWorker{
+			flagClose: func() {},
+			work: func(r tract.Request) (tract.Request, bool) {
+				atomic.AddInt64(&numberOfRequestsProcessed, 1)
+				return r, true
+			},
+		})),
+	)
+
+	err := myTract.Init()
+	if err != nil {
+		t.Fatalf("unexpected error during tract initialization %v", err)
+	}
+	myTract.Start()()
+
+	// The head keeps generating requests after the one it panicked on.
+	if numberOfPanics != 1 {
+		t.Errorf("number of panics: expected 1, received %d", numberOfPanics)
+	}
+	if numberOfRequestsProcessed != 9 {
+		t.Errorf("number of requests processed: expected 9, received %d", numberOfRequestsProcessed)
+	}
+}
+
+func TestStartDrainable(t *testing.T) {
+	newTract := func(tailWork time.Duration) tract.Tract {
+		return tract.NewSerialGroupTract("mySerialGroupTract",
+			// The head generates requests until it stops getting them from its input.
+			tract.NewWorkerTract("head", 1, tract.NewFactoryFromWorker(testWorker{
+				flagClose: func() {},
+				work: func(r tract.Request) (tract.Request, bool) {
+					return r, true
+				},
+			})),
+			tract.NewWorkerTract("tail", 1, tract.NewFactoryFromWorker(testWorker{
+				flagClose: func() {},
+				work: func(r tract.Request) (tract.Request, bool) {
+					time.Sleep(tailWork)
+					return r, true
+				},
+			}), tract.WithInputBuffer(5)),
+		)
+	}
+
+	// Requests in flight finish before the deadline.
+	myTract := newTract(time.Millisecond)
+	err := myTract.Init()
+	if err != nil {
+		t.Errorf("unexpected error during tract initialization %v", err)
+	}
+	drain := tract.StartDrainable(context.Background(), myTract)
+	time.Sleep(20 * time.Millisecond)
+	report := drain(5 * time.Second)
+	if report.Completed == 0 || report.Abandoned != 0 {
+		t.Errorf("drain report: expected only completed requests, received %+v", report)
+	}
+
+	// Requests in flight are abandoned once the deadline passes.
+	myTract = newTract(100 * time.Millisecond)
+	err = myTract.Init()
+	if err != nil {
+		t.Errorf("unexpected error during tract initialization %v", err)
+	}
+	drain = tract.StartDrainable(context.Background(), myTract)
+	time.Sleep(20 * time.Millisecond)
+	start := time.Now()
+	report = drain(50 * time.Millisecond)
+	if elapsed, expectedMaximumElapsed := time.Since(start), time.Second; elapsed > expectedMaximumElapsed {
+		t.Errorf("drain time: expected at most %v, received %v", expectedMaximumElapsed, elapsed)
+	}
+	// The buffered requests waiting on the tail are abandoned.
+	if report.Abandoned < 5 {
+		t.Errorf("drain report: expected at least 5 abandoned requests, received %+v", report)
+	}
+}
+
+// blockingInput is an InterruptibleInput that blocks while it waits for its next request.
+type blockingInput struct {
+	requests chan tract.Request
+}
+
+func (i blockingInput) Get() (tract.Request, bool) {
+	r, ok := <-i.requests
+	return r, ok
+}
+
+func (i blockingInput) GetContext(ctx context.Context) (tract.Request, bool) {
+	select {
+	case r, ok := <-i.requests:
+		return r, ok
+	case <-ctx.Done():
+		return nil, false
+	}
+}
+
+func TestStartDrainableBlockingInput(t *testing.T) {
+	myTract := tract.NewWorkerTract("blocked", 1, tract.NewFactoryFromWorker(testWorker{
+		flagClose: func() {},
+		work: func(r tract.Request) (tract.Request, bool) {
+			return r, true
+		},
+	}))
+	// The input never gets a request before the drain, and is never closed.
+	input := blockingInput{requests: make(chan tract.Request)}
+	myTract.SetInput(input)
+
+	err := myTract.Init()
+	if err != nil {
+		t.Fatalf("unexpected error during tract initialization %v", err)
+	}
+	drain := tract.StartDrainable(context.Background(), myTract)
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		drain(50 * time.Millisecond)
+	}()
+	select {
+	case <-drained:
+	case <-time.After(5 * time.Second):
+		t.Fatal("drain did not stop waiting on the input")
+	}
+
+	// Requests put to the input after the drain are left in it.
+	select {
+	case input.requests <- context.Background():
+		t.Error("request taken from the input after the drain")
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func TestInitRollback(t *testing.T) {
+	testErr := errors.New("test error")
+	var (
+		numberOfMadeWorkers   int64
+		numberOfWorkersClosed int64
+	)
+	newFactory := func(failAt int64) tract.WorkerFactory {
+		var numberOfFactoryWorkers int64
+		return testWorkerFactory{
+			flagMakeWorker: func() {},
+			flagClose:      func() {},
+			makeWorkerError: func() error {
+				if atomic.AddInt64(&numberOfFactoryWorkers, 1) == failAt {
+					return testErr
+				}
+				atomic.AddInt64(&numberOfMadeWorkers, 1)
+				return nil
+			},
+			Worker: testWorker{
+				flagClose: func() { atomic.AddInt64(&numberOfWorkersClosed, 1) },
+				work: func(r tract.Request) (tract.Request, bool) {
+					return r, true
+				},
+			},
+		}
+	}
+	myTract := tract.NewSerialGroupTract("pipeline",
+		tract.NewWorkerTract("read", 2, newFactory(0)),
+		tract.NewSerialGroupTract("inner",
+			tract.NewWorkerTract("parse", 8, newFactory(4)),
+		),
+	)
+	output := make(chan tract.Request)
+	myTract.SetOutput(tract.OutputChannel(output))
+
+	err := myTract.Init()
+	var initErr *tract.InitError
+	if !errors.As(err, &initErr) {
+		t.Fatalf("init error: expected *tract.InitError, received %v", err)
+	}
+	if expectedPath := "pipeline/inner/parse/worker[3]"; initErr.Path != expectedPath {
+		t.Errorf("init error path: expected %q, received %q", expectedPath, initErr.Path)
+	}
+	if !errors.Is(err, testErr) {
+		t.Errorf("init error: expected to wrap %v, received %v", testErr, err)
+	}
+	// Every worker made, in the failed tract and the tracts before it, is closed.
+	if numberOfWorkersClosed != numberOfMadeWorkers {
+		t.Errorf(`number of workers closed: expected %d, received %d`, numberOfMadeWorkers, numberOfWorkersClosed)
+	}
+	select {
+	case <-output:
+		t.Errorf("unexpected closed output")
+	default:
+	}
+}
+
+func TestMetricsTractPath(t *testing.T) {
+	// 20 requests
+	workSource := []struct{}{19: {}}
+	var (
+		metricsMutex sync.Mutex
+		// The workers that produced metrics for each tract path
+		pathWorkers = map[string]map[int]bool{}
+	)
+	metricsHandler := testMetricsHandler{handleMetrics: func(metrics ...tract.Metric) {
+		metricsMutex.Lock()
+		defer metricsMutex.Unlock()
+		for _, metric := range metrics {
+			if metric.Key != tract.MetricsKeyDuring {
+				continue
+			}
+			if !strings.HasSuffix(metric.Path, "/"+metric.Tract) {
+				t.Errorf("metric path %q does not end with its tract %q", metric.Path, metric.Tract)
+			}
+			if pathWorkers[metric.Path] == nil {
+				pathWorkers[metric.Path] = map[int]bool{}
+			}
+			pathWorkers[metric.Path][metric.Worker] = true
+		}
+	}}
+	passWorker := tract.NewFactoryFromWorker(testWorker{
+		flagClose: func() {},
+		work: func(r tract.Request) (tract.Request, bool) {
+			// Give every worker a chance to work a request.
+			time.Sleep(time.Millisecond)
+			return r, true
+		},
+	})
+	myTract := tract.NewSerialGroupTract("pipeline",
+		tract.NewWorkerTract("read", 1, tract.NewFactoryFromWorker(testWorker{
+			flagClose: func() {},
+			work: func(r tract.Request) (tract.Request, bool) {
+				if len(workSource) == 0 {
+					return r, false
+				}
+				workSource = workSource[1:]
+				return r, true
+			},
+		}), tract.WithMetricsHandler(metricsHandler)),
+		tract.NewParalellGroupTract("enrich",
+			tract.NewWorkerTract("geo", 2, passWorker, tract.WithMetricsHandler(metricsHandler)),
+			tract.NewWorkerTract("device", 2, passWorker, tract.WithMetricsHandler(metricsHandler)),
+		),
+	)
+
+	err := myTract.Init()
+	if err != nil {
+		t.Errorf("unexpected error during tract initialization %v", err)
+	}
+	myTract.Start()()
+
+	for path, expectedWorkers := range map[string]map[int]bool{
+		"pipeline/read":          {1: true},
+		"pipeline/enrich/geo":    {1: true, 2: true},
+		"pipeline/enrich/device": {1: true, 2: true},
+	} {
+		for worker := range pathWorkers[path] {
+			if !expectedWorkers[worker] {
+				t.Errorf("%s: unexpected metrics from worker %d", path, worker)
+			}
+		}
+		if len(pathWorkers[path]) == 0 {
+			t.Errorf("%s: expected metrics", path)
+		}
+		delete(pathWorkers, path)
+	}
+	for path := range pathWorkers {
+		t.Errorf("unexpected metrics for tract path %q", path)
+	}
+}
+
+func TestRequestCounters(t *testing.T) {
+	type testLabel struct{}
+	// 12 requests
+	workSource := []struct{}{11: {}}
+	var (
+		metricsMutex sync.Mutex
+		// Sum of the counts of each tract's requests
+		counts = map[string]map[tract.MetricsKey]int64{}
+		// The last amount of each tract's requests in flight
+		inFlight = map[string]int64{}
+	)
+	metricsHandler := testMetricsHandler{handleMetrics: func(metrics ...tract.Metric) {
+		metricsMutex.Lock()
+		defer metricsMutex.Unlock()
+		for _, metric := range metrics {
+			switch metric.Key {
+			case tract.MetricsKeyReceived, tract.MetricsKeyCompleted, tract.MetricsKeyRejected, tract.MetricsKeyFailed:
+				if counts[metric.Tract] == nil {
+					counts[metric.Tract] = map[tract.MetricsKey]int64{}
+				}
+				counts[metric.Tract][metric.Key] += metric.Count
+			case tract.MetricsKeyInFlight:
+				inFlight[metric.Tract] = metric.Count
+			case tract.MetricsKeyBusyWorkers:
+				if metric.Count < 0 || metric.Count > 2 {
+					t.Errorf("busy workers of tract %q: expected between 0 and 2, received %d", metric.Tract, metric.Count)
+				}
+			}
+		}
+	}}
+	myTract := tract.NewSerialGroupTract("pipeline",
+		tract.NewWorkerTract("head", 1, tract.NewFactoryFromWorker(testWorker{
+			flagClose: func() {},
+			work: func(r tract.Request) (tract.Request, bool) {
+				if len(workSource) == 0 {
+					return r, false
+				}
+				workSource = workSource[1:]
+				return context.WithValue(r, testLabel{}, len(workSource)), true
+			},
+		}), tract.WithMetricsHandler(metricsHandler)),
+		tract.NewWorkerTract("filter", 2, tract.NewFactoryFromWorker(testWorker{
+			flagClose: func() {},
+			work: func(r tract.Request) (tract.Request, bool) {
+				label, _ := r.Value(testLabel{}).(int)
+				return r, label%3 != 2
+			},
+		}), tract.WithMetricsHandler(metricsHandler)),
+		tract.NewWorkerTract("fail", 2, tract.NewFactoryFromWorker(tract.NewWorkerFromErrorWorker(testErrorWorker{
+			work: func(r tract.Request) (tract.Request, error) {
+				if label, _ := r.Value(testLabel{}).(int); label%3 == 1 {
+					return r, errors.New("failed request")
+				}
+				return r, nil
+			},
+		})), tract.WithMetricsHandler(metricsHandler)),
+	)
+
+	err := myTract.Init()
+	if err != nil {
+		t.Fatalf("unexpected error during tract initialization %v", err)
+	}
+	myTract.Start()()
+
+	expectedCounts := map[string]map[tract.MetricsKey]int64{
+		// The request signaling the head has no more requests is not counted.
+		"head": {
+			tract.MetricsKeyReceived:  12,
+			tract.MetricsKeyCompleted: 12,
+			tract.MetricsKeyRejected:  0,
+			tract.MetricsKeyFailed:    0,
+		},
+		"filter": {
+			tract.MetricsKeyReceived:  12,
+			tract.MetricsKeyCompleted: 8,
+			tract.MetricsKeyRejected:  4,
+			tract.MetricsKeyFailed:    0,
+		},
+		"fail": {
+			tract.MetricsKeyReceived:  8,
+			tract.MetricsKeyCompleted: 4,
+			tract.MetricsKeyRejected:  0,
+			tract.MetricsKeyFailed:    4,
+		},
+	}
+	if !reflect.DeepEqual(counts, expectedCounts) {
+		t.Errorf("request counts: expected %v, received %v", expectedCounts, counts)
+	}
+	for name, count := range inFlight {
+		if count != 0 {
+			t.Errorf("requests in flight in tract %q after it stopped: expected 0, received %d", name, count)
+		}
+	}
+
+	// Requests drained from a cancelled tract count as failed.
+	counts = map[string]map[tract.MetricsKey]int64{}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelledTract := tract.NewSerialGroupTract("cancelled",
+		tract.NewWorkerTract("head", 1, tract.NewFactoryFromWorker(testWorker{
+			flagClose: func() {},
+			work: func(r tract.Request) (tract.Request, bool) {
+				cancel()
+				return r, true
+			},
+		})),
+		tract.NewWorkerTract("drained", 1, tract.NewFactoryFromWorker(testWorker{
+			flagClose: func() {},
+			work: func(r tract.Request) (tract.Request, bool) {
+				t.Errorf("unexpected request worked after cancellation")
+				return r, true
+			},
+		}), tract.WithMetricsHandler(metricsHandler)),
+	)
+	err = cancelledTract.Init()
+	if err != nil {
+		t.Fatalf("unexpected error during tract initialization %v", err)
+	}
+	tract.StartContext(ctx, cancelledTract)()
+	expectedCounts = map[string]map[tract.MetricsKey]int64{
+		"drained": {
+			tract.MetricsKeyReceived:  1,
+			tract.MetricsKeyCompleted: 0,
+			tract.MetricsKeyRejected:  0,
+			tract.MetricsKeyFailed:    1,
+		},
+	}
+	if !reflect.DeepEqual(counts, expectedCounts) {
+		t.Errorf("cancelled request counts: expected %v, received %v", expectedCounts, counts)
+	}
+}
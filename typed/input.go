@@ -0,0 +1,42 @@
+package typed
+
+import "git.dev.kochava.com/ccurrin/tract"
+
+// Input specifies a way for a Tract to get typed requests.
+// It is the typed counterpart of tract.Input.
+type Input[T any] interface {
+	// Get gets the next request. The bool return value is true if a request was gotten.
+	// It's false when there is no requests and never will be any more.
+	Get() (Request[T], bool)
+}
+
+var (
+	_ Input[any]  = InputChannel[any](nil)
+	_ tract.Input = input[any]{}
+)
+
+// InputChannel is a channel of typed requests.
+type InputChannel[T any] <-chan Request[T]
+
+// Get gets the next request from the channel.
+func (c InputChannel[T]) Get() (Request[T], bool) {
+	request, ok := <-c
+	return request, ok
+}
+
+// AsInput makes a tract.Input from a typed Input.
+func AsInput[T any](in Input[T]) tract.Input {
+	return input[T]{input: in}
+}
+
+type input[T any] struct {
+	input Input[T]
+}
+
+func (i input[T]) Get() (tract.Request, bool) {
+	request, ok := i.input.Get()
+	if !ok {
+		return nil, false
+	}
+	return AsRequest(request), true
+}
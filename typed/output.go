@@ -0,0 +1,50 @@
+package typed
+
+import "git.dev.kochava.com/ccurrin/tract"
+
+// Output specifies a way for a Tract to pass typed requests along.
+// It is the typed counterpart of tract.Output.
+type Output[T any] interface {
+	// Put outputs the the request.
+	// Should never be called once Close has been called.
+	Put(Request[T])
+	// Close closes the output. No more requests should be outputted.
+	Close()
+}
+
+var (
+	_ Output[any]  = OutputChannel[any](nil)
+	_ tract.Output = output[any]{}
+)
+
+// OutputChannel is a channel of typed requests.
+type OutputChannel[T any] chan<- Request[T]
+
+// Put puts the request onto the channel.
+func (c OutputChannel[T]) Put(r Request[T]) {
+	c <- r
+}
+
+// Close closes the channel.
+func (c OutputChannel[T]) Close() {
+	close(c)
+}
+
+// AsOutput makes a tract.Output from a typed Output.
+// Requests without a payload of the output's type are outputted with the zero value as their payload.
+func AsOutput[T any](out Output[T]) tract.Output {
+	return output[T]{output: out}
+}
+
+type output[T any] struct {
+	output Output[T]
+}
+
+func (o output[T]) Put(r tract.Request) {
+	request, _ := FromRequest[T](r)
+	o.output.Put(request)
+}
+
+func (o output[T]) Close() {
+	o.output.Close()
+}
@@ -0,0 +1,48 @@
+// Package typed is a generic API for tracts, where workers pass data along as a typed payload
+// carried alongside the request's context instead of as context values.
+// Typed workers, inputs, and outputs are adapted into their tract counterparts, so they can be
+// used in the same tracts as any other Worker, Input, or Output.
+package typed
+
+import (
+	"context"
+
+	"git.dev.kochava.com/ccurrin/tract"
+)
+
+// Request is a tract Request carrying a typed payload.
+// The embedded tract Request keeps track of everything else, such as cleanups and metrics.
+type Request[T any] struct {
+	tract.Request
+	Payload T
+}
+
+// NewRequest makes a typed request from a context and a payload.
+func NewRequest[T any](ctx context.Context, payload T) Request[T] {
+	return Request[T]{
+		Request: ctx,
+		Payload: payload,
+	}
+}
+
+// payloadKey is the key to retreive the typed payload from a tract Request.
+// Request value type is the type of the payload
+type payloadKey struct{}
+
+// AsRequest turns a typed request into a tract Request, storing the payload on it.
+func AsRequest[T any](r Request[T]) tract.Request {
+	if r.Request == nil {
+		r.Request = context.Background()
+	}
+	return context.WithValue(r.Request, payloadKey{}, r.Payload)
+}
+
+// FromRequest turns a tract Request into a typed request. The bool return value is true if the
+// request had a payload of the requested type. When it's false, the payload is the zero value.
+func FromRequest[T any](r tract.Request) (Request[T], bool) {
+	payload, ok := r.Value(payloadKey{}).(T)
+	return Request[T]{
+		Request: r,
+		Payload: payload,
+	}, ok
+}
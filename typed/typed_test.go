@@ -0,0 +1,110 @@
+package typed_test
+
+import (
+	"context"
+	"math"
+	"sort"
+	"testing"
+
+	"git.dev.kochava.com/ccurrin/tract"
+	"git.dev.kochava.com/ccurrin/tract/typed"
+)
+
+type testWorker[T any] struct {
+	work func(typed.Request[T]) (typed.Request[T], bool)
+}
+
+func (w testWorker[T]) Work(r typed.Request[T]) (typed.Request[T], bool) {
+	return w.work(r)
+}
+
+func (w testWorker[T]) Close() {}
+
+func TestTypedWorkerTract(t *testing.T) {
+	var cleanedUp int
+	myTract := tract.NewSerialGroupTract("mySerialGroupTract",
+		typed.NewWorkerTract("square root", 4, typed.NewFactoryFromWorker[float64](testWorker[float64]{
+			work: func(r typed.Request[float64]) (typed.Request[float64], bool) {
+				r.Payload = math.Sqrt(r.Payload)
+				return r, true
+			},
+		})),
+		// Typed requests can be worked by any other tract.
+		tract.NewWorkerTract("negative", 2, tract.NewFactoryFromWorker(tract.NewWorkerFromErrorWorker(errorWorker{
+			work: func(r tract.Request) (tract.Request, error) {
+				request, ok := typed.FromRequest[float64](r)
+				if !ok {
+					t.Errorf("expected request to have a float64 payload")
+				}
+				request.Payload = -request.Payload
+				return typed.AsRequest(request), nil
+			},
+		}))),
+	)
+	input := make(chan typed.Request[float64])
+	output := make(chan typed.Request[float64])
+	myTract.SetInput(typed.AsInput[float64](typed.InputChannel[float64](input)))
+	myTract.SetOutput(typed.AsOutput[float64](typed.OutputChannel[float64](output)))
+
+	err := myTract.Init()
+	if err != nil {
+		t.Errorf("unexpected error during tract initialization %v", err)
+	}
+	wait := myTract.Start()
+
+	go func() {
+		defer close(input)
+		for _, arg := range []float64{1, 4, 9, 16} {
+			r := typed.NewRequest(context.Background(), arg)
+			r.Request = tract.AddRequestCleanup(r.Request, func(tract.Request, bool) {
+				cleanedUp++
+			})
+			input <- r
+		}
+	}()
+	var results []float64
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for r := range output {
+			results = append(results, r.Payload)
+			tract.CleanupRequest(r, true)
+		}
+	}()
+	wait()
+	<-done
+
+	sort.Float64s(results)
+	expectedResults := []float64{-4, -3, -2, -1}
+	if len(results) != len(expectedResults) {
+		t.Fatalf("results: expected %v, received %v", expectedResults, results)
+	}
+	for i := range expectedResults {
+		if results[i] != expectedResults[i] {
+			t.Errorf("results: expected %v, received %v", expectedResults, results)
+		}
+	}
+	if cleanedUp != len(expectedResults) {
+		t.Errorf("cleanups: expected %d, received %d", len(expectedResults), cleanedUp)
+	}
+}
+
+func TestTypedRequestConversion(t *testing.T) {
+	r := typed.AsRequest(typed.NewRequest(context.Background(), "payload"))
+	if request, ok := typed.FromRequest[string](r); !ok || request.Payload != "payload" {
+		t.Errorf("payload: expected %q, received %q (%v)", "payload", request.Payload, ok)
+	}
+	if request, ok := typed.FromRequest[int](r); ok || request.Payload != 0 {
+		t.Errorf("payload of another type: expected zero value, received %v (%v)", request.Payload, ok)
+	}
+}
+
+type errorWorker struct {
+	work func(tract.Request) (tract.Request, error)
+}
+
+func (w errorWorker) Work(r tract.Request) (tract.Request, error) {
+	return w.work(r)
+}
+
+func (w errorWorker) Close() {}
@@ -0,0 +1,101 @@
+package typed
+
+import "git.dev.kochava.com/ccurrin/tract"
+
+// WorkerFactory makes potentially many typed Worker objects that may use resources managed by the factory.
+// It is the typed counterpart of tract.WorkerFactory.
+type WorkerFactory[T any] interface {
+	// MakeWorker makes a worker expected to run in a tract.
+	MakeWorker() (Worker[T], error)
+	// Close closes factory resources
+	Close()
+}
+
+// Worker is an object that performs work on typed requests.
+// It is the typed counterpart of tract.Worker.
+type Worker[T any] interface {
+	// Work takes a request, performs an operation, and returns that request and a success flag.
+	// If the returned bool is false, that specifies that the returned request should be discarded.
+	// Arguments are read from the request's payload, and results are stored back to its payload.
+	Work(Request[T]) (Request[T], bool)
+	// Close closes worker resources
+	Close()
+}
+
+var (
+	_ tract.WorkerFactory = workerFactory[any]{}
+	_ tract.Worker        = worker[any]{}
+
+	_ WorkerFactory[any] = workerAsFactory[any]{}
+)
+
+// NewWorkerTract makes a new worker tract that will spin up @size number of typed workers generated from
+// @workerFactory. It is the same as tract.NewWorkerTract, and can be linked with any other tract.
+func NewWorkerTract[T any](name string, size int, workerFactory WorkerFactory[T], options ...tract.WorkerTractOption) tract.Tract {
+	return tract.NewWorkerTract(name, size, AsWorkerFactory(workerFactory), options...)
+}
+
+// NewFactoryFromWorker makes a WorkerFactory from a provided Worker, the same as tract.NewFactoryFromWorker.
+func NewFactoryFromWorker[T any](worker Worker[T]) WorkerFactory[T] {
+	return workerAsFactory[T]{worker: worker}
+}
+
+type workerAsFactory[T any] struct {
+	worker Worker[T]
+}
+
+func (f workerAsFactory[T]) MakeWorker() (Worker[T], error) {
+	return nonCloseWorker[T]{f.worker}, nil
+}
+
+func (f workerAsFactory[T]) Close() {
+	f.worker.Close()
+}
+
+type nonCloseWorker[T any] struct {
+	Worker[T]
+}
+
+func (w nonCloseWorker[T]) Close() {}
+
+// AsWorkerFactory makes a tract.WorkerFactory from a typed WorkerFactory.
+func AsWorkerFactory[T any](factory WorkerFactory[T]) tract.WorkerFactory {
+	return workerFactory[T]{factory: factory}
+}
+
+type workerFactory[T any] struct {
+	factory WorkerFactory[T]
+}
+
+func (f workerFactory[T]) MakeWorker() (tract.Worker, error) {
+	w, err := f.factory.MakeWorker()
+	if err != nil {
+		return nil, err
+	}
+	return AsWorker(w), nil
+}
+
+func (f workerFactory[T]) Close() {
+	f.factory.Close()
+}
+
+// AsWorker makes a tract.Worker from a typed Worker.
+// Requests without a payload of the worker's type, such as requests generated for a head tract,
+// are worked with the zero value as their payload.
+func AsWorker[T any](w Worker[T]) tract.Worker {
+	return worker[T]{worker: w}
+}
+
+type worker[T any] struct {
+	worker Worker[T]
+}
+
+func (w worker[T]) Work(r tract.Request) (tract.Request, bool) {
+	request, _ := FromRequest[T](r)
+	request, ok := w.worker.Work(request)
+	return AsRequest(request), ok
+}
+
+func (w worker[T]) Close() {
+	w.worker.Close()
+}
@@ -27,12 +27,25 @@ type Worker interface {
 	Close()
 }
 
+// ErrorWorker is an object that performs work similar to a Worker, but reports why work failed.
+// ErrorWorkers are used in a tract by adapting them into a Worker with NewWorkerFromErrorWorker.
+type ErrorWorker interface {
+	// Work takes a request, performs an operation, and returns that request and an error.
+	// If the returned error is not nil, the returned request is discarded, and the error
+	// is attached to it. It can be retrieved in the request's cleanups by using GetRequestError().
+	// For the head tract, returning an error signals that there are no more requests.
+	Work(Request) (Request, error)
+	// Close closes worker resources
+	Close()
+}
+
 var (
 	_ WorkerFactory = &tractWorkerFactory{}
 	_ WorkerFactory = workerAsFactory{}
 
 	_ Worker = MetricsWorker{}
 	_ Worker = tractWorker{}
+	_ Worker = errorWorker{}
 )
 
 // NewFactoryFromWorker makes a WorkerFactory from a provided Worker.
@@ -63,6 +76,30 @@ type nonCloseWorker struct {
 
 func (f nonCloseWorker) Close() {}
 
+// NewWorkerFromErrorWorker makes a Worker from a provided ErrorWorker.
+// Requests the ErrorWorker fails are discarded the same as a Worker returning
+// a "should not send", with the error attached to the request. If the ErrorWorker fails
+// without returning a request, the error is attached to the request it was given.
+func NewWorkerFromErrorWorker(worker ErrorWorker) Worker {
+	return errorWorker{ErrorWorker: worker}
+}
+
+type errorWorker struct {
+	ErrorWorker
+}
+
+func (w errorWorker) Work(r Request) (Request, bool) {
+	request, err := w.ErrorWorker.Work(r)
+	if err != nil {
+		if request == nil {
+			// ErrorWorkers may fail without returning a request, so the error is attached to the one they were given.
+			request = r
+		}
+		return setRequestError(request, err), false
+	}
+	return request, true
+}
+
 // MetricsWorker is a wrapper around a Worker that will automatically generate during latency metrics.
 type MetricsWorker struct {
 	Worker
@@ -79,9 +116,16 @@ func (w MetricsWorker) Work(r Request) (Request, bool) {
 		before := now()
 		request, ok = w.Worker.Work(r)
 		after := now()
-		w.metricsHandler.HandleMetrics(
-			Metric{MetricsKeyDuring, after.Sub(before)},
-		)
+		if !ok && GetRequestError(request) != nil {
+			w.metricsHandler.HandleMetrics(
+				Metric{Key: MetricsKeyDuring, Value: after.Sub(before)},
+				Metric{Key: MetricsKeyError, Value: after.Sub(before)},
+			)
+		} else {
+			w.metricsHandler.HandleMetrics(
+				Metric{Key: MetricsKeyDuring, Value: after.Sub(before)},
+			)
+		}
 	} else {
 		request, ok = w.Worker.Work(r)
 	}
@@ -149,11 +193,13 @@ func (w tractWorker) Work(originalRequest Request) (Request, bool) {
 	var (
 		preWorkTractRequest Request
 		deferedCleanups     cleanups
+		deferedFinalizers   cleanups
 		returnChannel       = make(chan requestSuccessTuple)
 	)
 	// Save the request cleanups for later. We do not want these cleanups to activate at the end of the tract
-	// we are sending this request down. Instead we will use this tract's cleanup to return it to us.
-	preWorkTractRequest, deferedCleanups = swapCleanups(originalRequest, cleanups{func(r Request, success bool) {
+	// we are sending this request down. Instead we will use this tract's finalizer to return it to us,
+	// once the cleanups added within the tract have run.
+	preWorkTractRequest, deferedCleanups, deferedFinalizers = swapCleanups(originalRequest, nil, cleanups{func(r Request, success bool) {
 		returnChannel <- requestSuccessTuple{
 			request: r,
 			success: success,
@@ -162,7 +208,7 @@ func (w tractWorker) Work(originalRequest Request) (Request, bool) {
 	w.in <- preWorkTractRequest
 	// Wait for the request to reach the end of the tract we sent it down where it will be cleaned up and sent back here.
 	postWorkTractRequest := <-returnChannel
-	postWorkTractRequest.request, _ = swapCleanups(postWorkTractRequest.request, deferedCleanups)
+	postWorkTractRequest.request, _, _ = swapCleanups(postWorkTractRequest.request, deferedCleanups, deferedFinalizers)
 	return postWorkTractRequest.request, postWorkTractRequest.success
 }
 
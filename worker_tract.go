@@ -1,13 +1,21 @@
 package tract
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"sync"
+	"time"
 )
 
+// ErrRequestRejected is the error attached to a request put to a reject output
+// when its worker rejected it without providing an error of its own.
+var ErrRequestRejected = errors.New("request rejected by worker")
+
 // NewWorkerTract makes a new tract that will spin up @size number of workers generated from @workerFactory
 // that get from the input and put to the output of the tract.
 func NewWorkerTract(name string, size int, workerFactory WorkerFactory, options ...WorkerTractOption) Tract {
-	return &workerTract{
+	p := &workerTract{
 		// input and output are overwritten when tracts are linked together
 		input:              InputGenerator{},
 		output:             FinalOutput{},
@@ -17,6 +25,10 @@ func NewWorkerTract(name string, size int, workerFactory WorkerFactory, options
 		options:            options,
 		shouldCloseFactory: false,
 	}
+	// Options are applied now for group tracts that need them to link this tract,
+	// and are applied again on startup.
+	p.applyOptions()
+	return p
 }
 
 type workerTract struct {
@@ -26,10 +38,14 @@ type workerTract struct {
 	input Input
 	// Output used by all workers
 	output Output
+	// Output used by all workers for requests they reject (optional)
+	rejectOutput Output
 	// Factory that makes the workers on demand
 	factory WorkerFactory
 	// Name of the Tract: used for logging and instrementation
 	name string
+	// Names of the groups the tract was started in, and the tract itself: used for instrementation
+	path string
 	// Amount of workers to start
 	size int
 	// Additonal options applied to the tract on startup
@@ -38,13 +54,41 @@ type workerTract struct {
 	// init() initialized fields
 
 	// Workers
-	workers []Worker
+	workers      []Worker
+	workersMutex sync.Mutex
 
 	// applyOptions() initialized fields
 
 	// Handler for request latency metrics within each running process in the tract
 	metricsHandler     MetricsHandler
 	shouldCloseFactory bool
+	// Policy for working failed requests again (optional)
+	retryPolicy RetryPolicy
+	// Amount of requests the link to this tract's input should hold
+	inputBuffer int
+	// What happens to requests put to the link to this tract's input when it is full
+	inputOverflowPolicy OverflowPolicy
+	// Grows and shrinks the amount of workers while running (optional)
+	autoscaler *autoscaler
+	// Amount of requests that can be reordered to keep output in input order, when positive
+	orderingWindow int
+	// Keeps output in input order when using an ordering window
+	sequencer *sequencer
+	// Batch tracts pass along whole batch requests instead of the requests in them
+	batchedOutput bool
+	// Limits the rate all workers process requests at (optional)
+	rateLimiter *rateLimiter
+	// Deadline given to each request as it enters the tract, when positive
+	requestTimeout time.Duration
+	// Recovers from workers panicking, failing the request they were working instead
+	panicRecovery bool
+	// Called with each request a worker panicked on (optional)
+	panicHandler func(Request, *PanicError)
+	// Replaces workers that panicked with new ones from the factory
+	replacePanickedWorkers bool
+
+	// Counts of the requests handled by all workers
+	counters tractCounters
 }
 
 func (p *workerTract) Name() string {
@@ -55,36 +99,92 @@ func (p *workerTract) Init() error {
 	// Close the workers just in case init was called multiple times
 	p.closeWorkers()
 	// Make all the  workers
-	p.workers = make([]Worker, p.size)
+	size := p.size
+	if p.autoscaler != nil {
+		if p.autoscaler.min > p.autoscaler.max || p.autoscaler.interval <= 0 {
+			return &InitError{Path: p.name, Err: ErrInvalidAutoscaling}
+		}
+		size = p.autoscaler.clamp(size)
+	}
+	p.workers = make([]Worker, size)
 	var err error
 	for i := range p.workers {
 		p.workers[i], err = p.factory.MakeWorker()
 		if err != nil {
-			p.close()
-			return err
+			p.deinit()
+			return &InitError{Path: fmt.Sprintf("%s/worker[%d]", p.name, i), Err: err}
 		}
 	}
 	return nil
 }
 
+// deinit closes the workers made by Init, and the factory if the tract should close it,
+// without closing the outputs that are linked to other tracts.
+func (p *workerTract) deinit() {
+	p.closeWorkers()
+	p.workers = nil
+	if p.shouldCloseFactory {
+		p.factory.Close()
+	}
+}
+
 func (p *workerTract) Start() func() {
+	return p.StartContext(context.Background())
+}
+
+func (p *workerTract) StartContext(ctx context.Context) func() {
 	p.applyOptions()
+	p.path = joinTractPath(tractPath(ctx), p.name)
+	p.sequencer = nil
+	if p.orderingWindow > 0 {
+		p.sequencer = newSequencer(p.orderingWindow)
+	}
+	if p.autoscaler != nil {
+		p.autoscaler.running = len(p.workers)
+	}
 	// Start all the processors
 	workerWG := &sync.WaitGroup{}
 	for i := range p.workers {
-		workerWG.Add(1)
-		go func(worker Worker) {
-			defer workerWG.Done()
-			process(p.input, worker, p.output, p.metricsHandler)
-		}(p.workers[i])
+		p.startWorker(ctx, workerWG, i, p.workers[i])
 	}
-	// Automatically close all the workers, the factory, and the output when all the workers finish.
+	if p.autoscaler == nil {
+		// Automatically close all the workers, the factory, and the output when all the workers finish.
+		return func() {
+			workerWG.Wait()
+			p.close()
+		}
+	}
+	stopAutoscaling := make(chan struct{})
+	autoscalingDone := make(chan struct{})
+	go func() {
+		defer close(autoscalingDone)
+		p.autoscale(ctx, workerWG, stopAutoscaling)
+	}()
 	return func() {
 		workerWG.Wait()
+		close(stopAutoscaling)
+		<-autoscalingDone
 		p.close()
 	}
 }
 
+// startWorker starts processing requests with @worker, which is at index @i of the tract's workers.
+func (p *workerTract) startWorker(ctx context.Context, workerWG *sync.WaitGroup, i int, worker Worker) {
+	workerWG.Add(1)
+	go func(worker Worker) {
+		defer workerWG.Done()
+		retired := p.process(ctx, i, worker)
+		if p.autoscaler == nil {
+			return
+		}
+		if retired {
+			p.retireWorker(i)
+		} else {
+			p.finishWorker()
+		}
+	}(worker)
+}
+
 func (p *workerTract) SetInput(in Input) {
 	p.input = in
 }
@@ -93,6 +193,21 @@ func (p *workerTract) SetOutput(out Output) {
 	p.output = out
 }
 
+func (p *workerTract) SetRejectOutput(out Output) {
+	p.rejectOutput = out
+}
+
+func (p *workerTract) inputBufferSize() int {
+	return p.inputBuffer
+}
+
+func (p *workerTract) overflowPolicy() (OverflowPolicy, MetricsHandler) {
+	if p.metricsHandler == nil {
+		return p.inputOverflowPolicy, nil
+	}
+	return p.inputOverflowPolicy, linkMetricsHandler{p}
+}
+
 // This is called upon starting the tract; ensuring any changes to input or output has taken place before being called.
 func (p *workerTract) applyOptions() {
 	for _, option := range p.options {
@@ -101,13 +216,28 @@ func (p *workerTract) applyOptions() {
 }
 
 func (p *workerTract) close() {
+	if p.metricsHandler != nil {
+		// Report the counts of requests handled since the workers last reported them.
+		p.counters.report(newTractMetricsHandler(p.metricsHandler, p.name, p.path, -1), p.numberOfWorkers())
+	}
 	p.closeWorkers()
 	p.output.Close()
+	if p.rejectOutput != nil {
+		p.rejectOutput.Close()
+	}
 	if p.shouldCloseFactory {
 		p.factory.Close()
 	}
 }
 
+// singleWorker checks if the tract never has more than one worker.
+func (p *workerTract) singleWorker() bool {
+	if p.autoscaler != nil {
+		return p.autoscaler.max <= 1
+	}
+	return p.size <= 1
+}
+
 func (p *workerTract) closeWorkers() {
 	for i := range p.workers {
 		if worker := p.workers[i]; worker != nil {
@@ -116,37 +246,192 @@ func (p *workerTract) closeWorkers() {
 	}
 }
 
-func process(input Input, worker Worker, output Output, metricsHandler MetricsHandler) {
+// process gets, works and outputs requests with @worker, which is at index @i of the tract's workers,
+// until there are no more requests.
+// It returns true if it stopped early because the tract is shrinking its amount of workers.
+func (p *workerTract) process(ctx context.Context, i int, worker Worker) bool {
 	var (
+		metricsHandler = newTractMetricsHandler(p.metricsHandler, p.name, p.path, i)
+		// Handler for metrics about the tract as a whole rather than this worker
+		countersHandler = newTractMetricsHandler(p.metricsHandler, p.name, p.path, -1)
+
 		mh  = &manualOverrideMetricsHandler{MetricsHandler: metricsHandler}
-		in  = MetricsInput{Input: input, metricsHandler: mh}
-		w   = MetricsWorker{Worker: worker, metricsHandler: mh}
-		out = MetricsOutput{Output: output, metricsHandler: mh}
+		in  = MetricsInput{Input: contextInput{Input: p.input, ctx: ctx}, metricsHandler: mh}
+		w   = MetricsWorker{Worker: p.wrapWorker(i, worker, mh), metricsHandler: mh}
+		out = MetricsOutput{Output: p.wrapOutput(p.output), metricsHandler: mh}
 
 		outputRequest Request
 		shouldSend    bool
 
 		inputRequest Request
 		ok           bool
+		sequence     uint64
 
-		_, isHeadTract = input.(InputGenerator)
+		_, isHeadTract = p.input.(InputGenerator)
 	)
 	for {
+		if p.autoscaler != nil && p.autoscaler.shouldRetire() {
+			return true
+		}
+		if mh.ShouldHandle() {
+			// Report the tract's counts after the metrics of the last request the worker handled.
+			p.counters.report(countersHandler, p.numberOfWorkers())
+		}
 		mh.SetShouldHandle(metricsHandler != nil && metricsHandler.ShouldHandle())
-		inputRequest, ok = in.Get()
+		if p.sequencer != nil {
+			inputRequest, sequence, ok = p.sequencer.get(in)
+		} else {
+			inputRequest, ok = in.Get()
+		}
 		if !ok {
 			break
 		}
+		// Head tracts generate requests with their workers, so they only count the requests their workers generated.
+		counted := !isHeadTract
+		if counted {
+			p.counters.receive()
+		}
+		if p.requestTimeout > 0 {
+			// The deadline starts as the request enters the tract, including any time it waits on the rate limit.
+			inputRequest = withRequestTimeout(inputRequest, p.requestTimeout)
+		}
+		if ctx.Err() != nil || (p.rateLimiter != nil && !p.rateLimiter.wait(ctx, mh)) {
+			// The tract has been cancelled. Drain requests still in flight without working them.
+			p.skip(sequence, out)
+			if counted {
+				p.counters.fail()
+			}
+			cleanupRequest(inputRequest, false)
+			continue
+		}
+		if requestTimedOut(inputRequest) {
+			// The request's deadline passed before it could be worked.
+			p.skip(sequence, out)
+			p.rejectTimedOut(inputRequest, counted)
+			continue
+		}
+		p.counters.work(true)
 		outputRequest, shouldSend = w.Work(inputRequest)
+		p.counters.work(false)
+		if !counted && (shouldSend || p.recoveredPanic(outputRequest)) {
+			counted = true
+			p.counters.receive()
+		}
+		if shouldSend && requestTimedOut(outputRequest) {
+			// The request's deadline passed while it was being worked.
+			p.skip(sequence, out)
+			p.rejectTimedOut(outputRequest, true)
+			continue
+		}
 		if shouldSend {
-			out.Put(outputRequest)
-		} else {
+			p.counters.finish(outputRequest, true)
+			p.put(sequence, outputRequest, out)
+		} else if isHeadTract && !p.recoveredPanic(outputRequest) {
+			// If this is the head tract, then the worker is responsible for termination.
+			// If the worker returns a "should not send" result, this is the signal to stop processing.
+			// A worker that panicked is not signaling that, so its request is rejected like any other.
+			p.skip(sequence, out)
 			cleanupRequest(outputRequest, false)
-			if isHeadTract {
-				// If this is the head tract, then the worker is responsible for termination.
-				// If the worker returns a "should not send" result, this is the signal to stop processing.
-				break
+			break
+		} else {
+			p.skip(sequence, out)
+			p.counters.finish(outputRequest, false)
+			p.reject(outputRequest)
+		}
+	}
+	return false
+}
+
+// put puts a worked request to the output, in input order if the tract is ordered.
+func (p *workerTract) put(sequence uint64, r Request, out Output) {
+	if p.sequencer != nil {
+		p.sequencer.put(sequence, r, out)
+		return
+	}
+	out.Put(r)
+}
+
+// skip lets later requests be outputted without waiting on a request that will not be, if the tract is ordered.
+func (p *workerTract) skip(sequence uint64, out Output) {
+	if p.sequencer != nil {
+		p.sequencer.skip(sequence, out)
+	}
+}
+
+// wrapWorker wraps a worker at index @i of the tract's workers with any behavior specified by the tract's options.
+func (p *workerTract) wrapWorker(i int, worker Worker, mh MetricsHandler) Worker {
+	if p.panicRecovery {
+		recoverer := &recoverWorker{
+			worker:         worker,
+			handler:        p.panicHandler,
+			metricsHandler: mh,
+		}
+		if p.replacePanickedWorkers {
+			recoverer.replace = func() (Worker, error) {
+				return p.replaceWorker(i)
 			}
 		}
+		worker = recoverer
 	}
+	if p.retryPolicy != nil {
+		worker = retryWorker{
+			Worker:         worker,
+			policy:         p.retryPolicy,
+			metricsHandler: mh,
+		}
+	}
+	if p.autoscaler != nil {
+		worker = autoscaleWorker{
+			Worker:     worker,
+			autoscaler: p.autoscaler,
+		}
+	}
+	return worker
+}
+
+// wrapOutput wraps an output with any behavior specified by the tract's options.
+func (p *workerTract) wrapOutput(output Output) Output {
+	if p.autoscaler != nil {
+		output = autoscaleOutput{
+			Output:     output,
+			autoscaler: p.autoscaler,
+		}
+	}
+	return output
+}
+
+// rejectTimedOut rejects a request whose deadline passed, counting it as failed if it was @counted as received.
+func (p *workerTract) rejectTimedOut(r Request, counted bool) {
+	r = setRequestError(r, r.Err())
+	if counted {
+		p.counters.finish(r, false)
+	}
+	p.reject(r)
+}
+
+// reject sends a request a worker rejected to the reject output, or cleans it up if there is none.
+func (p *workerTract) reject(r Request) {
+	if p.rejectOutput == nil {
+		cleanupRequest(r, false)
+		return
+	}
+	r = setRequestRejectedBy(r, p.name)
+	if GetRequestError(r) == nil {
+		r = setRequestError(r, ErrRequestRejected)
+	}
+	p.rejectOutput.Put(r)
+}
+
+// linkMetricsHandler is the metrics handler for the link to a worker tract's input.
+// The link is made before the tract is started, so metrics are labeled with the tract's path once it has one.
+type linkMetricsHandler struct {
+	p *workerTract
+}
+
+func (h linkMetricsHandler) HandleMetrics(metrics ...Metric) {
+	newTractMetricsHandler(h.p.metricsHandler, h.p.name, h.p.path, -1).HandleMetrics(metrics...)
+}
+
+func (h linkMetricsHandler) ShouldHandle() bool {
+	return h.p.metricsHandler.ShouldHandle()
 }